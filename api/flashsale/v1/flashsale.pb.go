@@ -0,0 +1,1122 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: api/flashsale/v1/flashsale.proto
+
+package flashsalev1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ItemAvailability int32
+
+const (
+	ItemAvailability_ITEM_AVAILABILITY_UNSPECIFIED ItemAvailability = 0
+	ItemAvailability_ITEM_AVAILABILITY_AVAILABLE   ItemAvailability = 1
+	// No units are available at the moment, but some of them are reserved and may be back.
+	ItemAvailability_ITEM_AVAILABILITY_RESERVED ItemAvailability = 2
+	ItemAvailability_ITEM_AVAILABILITY_SOLD     ItemAvailability = 3
+)
+
+// Enum value maps for ItemAvailability.
+var (
+	ItemAvailability_name = map[int32]string{
+		0: "ITEM_AVAILABILITY_UNSPECIFIED",
+		1: "ITEM_AVAILABILITY_AVAILABLE",
+		2: "ITEM_AVAILABILITY_RESERVED",
+		3: "ITEM_AVAILABILITY_SOLD",
+	}
+	ItemAvailability_value = map[string]int32{
+		"ITEM_AVAILABILITY_UNSPECIFIED": 0,
+		"ITEM_AVAILABILITY_AVAILABLE":   1,
+		"ITEM_AVAILABILITY_RESERVED":    2,
+		"ITEM_AVAILABILITY_SOLD":        3,
+	}
+)
+
+func (x ItemAvailability) Enum() *ItemAvailability {
+	p := new(ItemAvailability)
+	*p = x
+	return p
+}
+
+func (x ItemAvailability) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ItemAvailability) Descriptor() protoreflect.EnumDescriptor {
+	return file_api_flashsale_v1_flashsale_proto_enumTypes[0].Descriptor()
+}
+
+func (ItemAvailability) Type() protoreflect.EnumType {
+	return &file_api_flashsale_v1_flashsale_proto_enumTypes[0]
+}
+
+func (x ItemAvailability) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ItemAvailability.Descriptor instead.
+func (ItemAvailability) EnumDescriptor() ([]byte, []int) {
+	return file_api_flashsale_v1_flashsale_proto_rawDescGZIP(), []int{0}
+}
+
+type CartItem struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	ItemId int64                  `protobuf:"varint,1,opt,name=item_id,json=itemId,proto3" json:"item_id,omitempty"`
+	// 1 if not set.
+	Quantity      int32 `protobuf:"varint,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CartItem) Reset() {
+	*x = CartItem{}
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CartItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CartItem) ProtoMessage() {}
+
+func (x *CartItem) ProtoReflect() protoreflect.Message {
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CartItem.ProtoReflect.Descriptor instead.
+func (*CartItem) Descriptor() ([]byte, []int) {
+	return file_api_flashsale_v1_flashsale_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CartItem) GetItemId() int64 {
+	if x != nil {
+		return x.ItemId
+	}
+	return 0
+}
+
+func (x *CartItem) GetQuantity() int32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+type CheckoutRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        int64                  `protobuf:"varint,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Items         []*CartItem            `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckoutRequest) Reset() {
+	*x = CheckoutRequest{}
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckoutRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckoutRequest) ProtoMessage() {}
+
+func (x *CheckoutRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckoutRequest.ProtoReflect.Descriptor instead.
+func (*CheckoutRequest) Descriptor() ([]byte, []int) {
+	return file_api_flashsale_v1_flashsale_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CheckoutRequest) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *CheckoutRequest) GetItems() []*CartItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type CheckoutResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Code  string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	// Not set for unsigned codes.
+	ReservedUntil *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=reserved_until,json=reservedUntil,proto3" json:"reserved_until,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckoutResponse) Reset() {
+	*x = CheckoutResponse{}
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckoutResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckoutResponse) ProtoMessage() {}
+
+func (x *CheckoutResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckoutResponse.ProtoReflect.Descriptor instead.
+func (*CheckoutResponse) Descriptor() ([]byte, []int) {
+	return file_api_flashsale_v1_flashsale_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CheckoutResponse) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *CheckoutResponse) GetReservedUntil() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ReservedUntil
+	}
+	return nil
+}
+
+type PurchaseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PurchaseRequest) Reset() {
+	*x = PurchaseRequest{}
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PurchaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurchaseRequest) ProtoMessage() {}
+
+func (x *PurchaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurchaseRequest.ProtoReflect.Descriptor instead.
+func (*PurchaseRequest) Descriptor() ([]byte, []int) {
+	return file_api_flashsale_v1_flashsale_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PurchaseRequest) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+type PurchaseResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Orders        []*Order               `protobuf:"bytes,1,rep,name=orders,proto3" json:"orders,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PurchaseResponse) Reset() {
+	*x = PurchaseResponse{}
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PurchaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurchaseResponse) ProtoMessage() {}
+
+func (x *PurchaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurchaseResponse.ProtoReflect.Descriptor instead.
+func (*PurchaseResponse) Descriptor() ([]byte, []int) {
+	return file_api_flashsale_v1_flashsale_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PurchaseResponse) GetOrders() []*Order {
+	if x != nil {
+		return x.Orders
+	}
+	return nil
+}
+
+type Order struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Id        int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	CreatedAt *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UserId    int64                  `protobuf:"varint,3,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	ItemId    int64                  `protobuf:"varint,4,opt,name=item_id,json=itemId,proto3" json:"item_id,omitempty"`
+	SaleId    int64                  `protobuf:"varint,5,opt,name=sale_id,json=saleId,proto3" json:"sale_id,omitempty"`
+	Quantity  int32                  `protobuf:"varint,6,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	// Prices are in minor units (e.g. cents) of the currency.
+	Price            int64  `protobuf:"varint,7,opt,name=price,proto3" json:"price,omitempty"`
+	OriginalPrice    int64  `protobuf:"varint,8,opt,name=original_price,json=originalPrice,proto3" json:"original_price,omitempty"`
+	Currency         string `protobuf:"bytes,9,opt,name=currency,proto3" json:"currency,omitempty"`
+	RefundedQuantity int32  `protobuf:"varint,10,opt,name=refunded_quantity,json=refundedQuantity,proto3" json:"refunded_quantity,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Order) Reset() {
+	*x = Order{}
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Order) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Order) ProtoMessage() {}
+
+func (x *Order) ProtoReflect() protoreflect.Message {
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Order.ProtoReflect.Descriptor instead.
+func (*Order) Descriptor() ([]byte, []int) {
+	return file_api_flashsale_v1_flashsale_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Order) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Order) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Order) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *Order) GetItemId() int64 {
+	if x != nil {
+		return x.ItemId
+	}
+	return 0
+}
+
+func (x *Order) GetSaleId() int64 {
+	if x != nil {
+		return x.SaleId
+	}
+	return 0
+}
+
+func (x *Order) GetQuantity() int32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *Order) GetPrice() int64 {
+	if x != nil {
+		return x.Price
+	}
+	return 0
+}
+
+func (x *Order) GetOriginalPrice() int64 {
+	if x != nil {
+		return x.OriginalPrice
+	}
+	return 0
+}
+
+func (x *Order) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+func (x *Order) GetRefundedQuantity() int32 {
+	if x != nil {
+		return x.RefundedQuantity
+	}
+	return 0
+}
+
+type Item struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Id                int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	CreatedAt         *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	Name              string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	SaleId            int64                  `protobuf:"varint,4,opt,name=sale_id,json=saleId,proto3" json:"sale_id,omitempty"`
+	Sold              bool                   `protobuf:"varint,5,opt,name=sold,proto3" json:"sold,omitempty"`
+	Quantity          int32                  `protobuf:"varint,6,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	AvailableQuantity int32                  `protobuf:"varint,7,opt,name=available_quantity,json=availableQuantity,proto3" json:"available_quantity,omitempty"`
+	ReservedQuantity  int32                  `protobuf:"varint,8,opt,name=reserved_quantity,json=reservedQuantity,proto3" json:"reserved_quantity,omitempty"`
+	SoldQuantity      int32                  `protobuf:"varint,9,opt,name=sold_quantity,json=soldQuantity,proto3" json:"sold_quantity,omitempty"`
+	Availability      ItemAvailability       `protobuf:"varint,10,opt,name=availability,proto3,enum=flashsale.v1.ItemAvailability" json:"availability,omitempty"`
+	Price             int64                  `protobuf:"varint,11,opt,name=price,proto3" json:"price,omitempty"`
+	OriginalPrice     int64                  `protobuf:"varint,12,opt,name=original_price,json=originalPrice,proto3" json:"original_price,omitempty"`
+	Currency          string                 `protobuf:"bytes,13,opt,name=currency,proto3" json:"currency,omitempty"`
+	DiscountPercent   int32                  `protobuf:"varint,14,opt,name=discount_percent,json=discountPercent,proto3" json:"discount_percent,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *Item) Reset() {
+	*x = Item{}
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Item) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Item) ProtoMessage() {}
+
+func (x *Item) ProtoReflect() protoreflect.Message {
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Item.ProtoReflect.Descriptor instead.
+func (*Item) Descriptor() ([]byte, []int) {
+	return file_api_flashsale_v1_flashsale_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Item) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Item) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Item) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Item) GetSaleId() int64 {
+	if x != nil {
+		return x.SaleId
+	}
+	return 0
+}
+
+func (x *Item) GetSold() bool {
+	if x != nil {
+		return x.Sold
+	}
+	return false
+}
+
+func (x *Item) GetQuantity() int32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *Item) GetAvailableQuantity() int32 {
+	if x != nil {
+		return x.AvailableQuantity
+	}
+	return 0
+}
+
+func (x *Item) GetReservedQuantity() int32 {
+	if x != nil {
+		return x.ReservedQuantity
+	}
+	return 0
+}
+
+func (x *Item) GetSoldQuantity() int32 {
+	if x != nil {
+		return x.SoldQuantity
+	}
+	return 0
+}
+
+func (x *Item) GetAvailability() ItemAvailability {
+	if x != nil {
+		return x.Availability
+	}
+	return ItemAvailability_ITEM_AVAILABILITY_UNSPECIFIED
+}
+
+func (x *Item) GetPrice() int64 {
+	if x != nil {
+		return x.Price
+	}
+	return 0
+}
+
+func (x *Item) GetOriginalPrice() int64 {
+	if x != nil {
+		return x.OriginalPrice
+	}
+	return 0
+}
+
+func (x *Item) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+func (x *Item) GetDiscountPercent() int32 {
+	if x != nil {
+		return x.DiscountPercent
+	}
+	return 0
+}
+
+type ListItemsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 0 for any sale.
+	SaleId int64 `protobuf:"varint,1,opt,name=sale_id,json=saleId,proto3" json:"sale_id,omitempty"`
+	// Whether the whole stock is sold out, both if not set.
+	Sold *bool `protobuf:"varint,2,opt,name=sold,proto3,oneof" json:"sold,omitempty"`
+	// Only the items which can be checked out at the moment.
+	AvailableNow bool `protobuf:"varint,3,opt,name=available_now,json=availableNow,proto3" json:"available_now,omitempty"`
+	// Case-insensitive substring of the name.
+	Search string `protobuf:"bytes,4,opt,name=search,proto3" json:"search,omitempty"`
+	// One of id (default), name, price, discount_percent or created_at, prefixed with "-" for descending order.
+	Sort string `protobuf:"bytes,5,opt,name=sort,proto3" json:"sort,omitempty"`
+	// 10 if not set.
+	PageSize int32 `protobuf:"varint,6,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// next_page_token of the previous page, empty for the first page. Valid only for the same sort.
+	PageToken     string `protobuf:"bytes,7,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListItemsRequest) Reset() {
+	*x = ListItemsRequest{}
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListItemsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListItemsRequest) ProtoMessage() {}
+
+func (x *ListItemsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListItemsRequest.ProtoReflect.Descriptor instead.
+func (*ListItemsRequest) Descriptor() ([]byte, []int) {
+	return file_api_flashsale_v1_flashsale_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListItemsRequest) GetSaleId() int64 {
+	if x != nil {
+		return x.SaleId
+	}
+	return 0
+}
+
+func (x *ListItemsRequest) GetSold() bool {
+	if x != nil && x.Sold != nil {
+		return *x.Sold
+	}
+	return false
+}
+
+func (x *ListItemsRequest) GetAvailableNow() bool {
+	if x != nil {
+		return x.AvailableNow
+	}
+	return false
+}
+
+func (x *ListItemsRequest) GetSearch() string {
+	if x != nil {
+		return x.Search
+	}
+	return ""
+}
+
+func (x *ListItemsRequest) GetSort() string {
+	if x != nil {
+		return x.Sort
+	}
+	return ""
+}
+
+func (x *ListItemsRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *ListItemsRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+type ListItemsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Items []*Item                `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	// Empty on the last page.
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListItemsResponse) Reset() {
+	*x = ListItemsResponse{}
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListItemsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListItemsResponse) ProtoMessage() {}
+
+func (x *ListItemsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListItemsResponse.ProtoReflect.Descriptor instead.
+func (*ListItemsResponse) Descriptor() ([]byte, []int) {
+	return file_api_flashsale_v1_flashsale_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListItemsResponse) GetItems() []*Item {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *ListItemsResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+type Sale struct {
+	state                  protoimpl.MessageState `protogen:"open.v1"`
+	Id                     int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	CreatedAt              *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	StartAt                *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=start_at,json=startAt,proto3" json:"start_at,omitempty"`
+	EndAt                  *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=end_at,json=endAt,proto3" json:"end_at,omitempty"`
+	Paused                 bool                   `protobuf:"varint,5,opt,name=paused,proto3" json:"paused,omitempty"`
+	PurchasesLimit         int32                  `protobuf:"varint,6,opt,name=purchases_limit,json=purchasesLimit,proto3" json:"purchases_limit,omitempty"`
+	CheckoutTimeoutSeconds int64                  `protobuf:"varint,7,opt,name=checkout_timeout_seconds,json=checkoutTimeoutSeconds,proto3" json:"checkout_timeout_seconds,omitempty"`
+	ItemsCount             int32                  `protobuf:"varint,8,opt,name=items_count,json=itemsCount,proto3" json:"items_count,omitempty"`
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *Sale) Reset() {
+	*x = Sale{}
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Sale) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Sale) ProtoMessage() {}
+
+func (x *Sale) ProtoReflect() protoreflect.Message {
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Sale.ProtoReflect.Descriptor instead.
+func (*Sale) Descriptor() ([]byte, []int) {
+	return file_api_flashsale_v1_flashsale_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Sale) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Sale) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Sale) GetStartAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartAt
+	}
+	return nil
+}
+
+func (x *Sale) GetEndAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndAt
+	}
+	return nil
+}
+
+func (x *Sale) GetPaused() bool {
+	if x != nil {
+		return x.Paused
+	}
+	return false
+}
+
+func (x *Sale) GetPurchasesLimit() int32 {
+	if x != nil {
+		return x.PurchasesLimit
+	}
+	return 0
+}
+
+func (x *Sale) GetCheckoutTimeoutSeconds() int64 {
+	if x != nil {
+		return x.CheckoutTimeoutSeconds
+	}
+	return 0
+}
+
+func (x *Sale) GetItemsCount() int32 {
+	if x != nil {
+		return x.ItemsCount
+	}
+	return 0
+}
+
+type ListSalesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 10 if not set.
+	PageSize int32 `protobuf:"varint,1,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// next_page_token of the previous page, empty for the first page.
+	PageToken     string `protobuf:"bytes,2,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListSalesRequest) Reset() {
+	*x = ListSalesRequest{}
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSalesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSalesRequest) ProtoMessage() {}
+
+func (x *ListSalesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSalesRequest.ProtoReflect.Descriptor instead.
+func (*ListSalesRequest) Descriptor() ([]byte, []int) {
+	return file_api_flashsale_v1_flashsale_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListSalesRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *ListSalesRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+type ListSalesResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Sales []*Sale                `protobuf:"bytes,1,rep,name=sales,proto3" json:"sales,omitempty"`
+	// Empty on the last page.
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListSalesResponse) Reset() {
+	*x = ListSalesResponse{}
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSalesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSalesResponse) ProtoMessage() {}
+
+func (x *ListSalesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_flashsale_v1_flashsale_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSalesResponse.ProtoReflect.Descriptor instead.
+func (*ListSalesResponse) Descriptor() ([]byte, []int) {
+	return file_api_flashsale_v1_flashsale_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ListSalesResponse) GetSales() []*Sale {
+	if x != nil {
+		return x.Sales
+	}
+	return nil
+}
+
+func (x *ListSalesResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+var File_api_flashsale_v1_flashsale_proto protoreflect.FileDescriptor
+
+const file_api_flashsale_v1_flashsale_proto_rawDesc = "" +
+	"\n" +
+	" api/flashsale/v1/flashsale.proto\x12\fflashsale.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"?\n" +
+	"\bCartItem\x12\x17\n" +
+	"\aitem_id\x18\x01 \x01(\x03R\x06itemId\x12\x1a\n" +
+	"\bquantity\x18\x02 \x01(\x05R\bquantity\"X\n" +
+	"\x0fCheckoutRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\x03R\x06userId\x12,\n" +
+	"\x05items\x18\x02 \x03(\v2\x16.flashsale.v1.CartItemR\x05items\"i\n" +
+	"\x10CheckoutResponse\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12A\n" +
+	"\x0ereserved_until\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\rreservedUntil\"%\n" +
+	"\x0fPurchaseRequest\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\"?\n" +
+	"\x10PurchaseResponse\x12+\n" +
+	"\x06orders\x18\x01 \x03(\v2\x13.flashsale.v1.OrderR\x06orders\"\xbf\x02\n" +
+	"\x05Order\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x129\n" +
+	"\n" +
+	"created_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12\x17\n" +
+	"\auser_id\x18\x03 \x01(\x03R\x06userId\x12\x17\n" +
+	"\aitem_id\x18\x04 \x01(\x03R\x06itemId\x12\x17\n" +
+	"\asale_id\x18\x05 \x01(\x03R\x06saleId\x12\x1a\n" +
+	"\bquantity\x18\x06 \x01(\x05R\bquantity\x12\x14\n" +
+	"\x05price\x18\a \x01(\x03R\x05price\x12%\n" +
+	"\x0eoriginal_price\x18\b \x01(\x03R\roriginalPrice\x12\x1a\n" +
+	"\bcurrency\x18\t \x01(\tR\bcurrency\x12+\n" +
+	"\x11refunded_quantity\x18\n" +
+	" \x01(\x05R\x10refundedQuantity\"\xf7\x03\n" +
+	"\x04Item\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x129\n" +
+	"\n" +
+	"created_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x12\x17\n" +
+	"\asale_id\x18\x04 \x01(\x03R\x06saleId\x12\x12\n" +
+	"\x04sold\x18\x05 \x01(\bR\x04sold\x12\x1a\n" +
+	"\bquantity\x18\x06 \x01(\x05R\bquantity\x12-\n" +
+	"\x12available_quantity\x18\a \x01(\x05R\x11availableQuantity\x12+\n" +
+	"\x11reserved_quantity\x18\b \x01(\x05R\x10reservedQuantity\x12#\n" +
+	"\rsold_quantity\x18\t \x01(\x05R\fsoldQuantity\x12B\n" +
+	"\favailability\x18\n" +
+	" \x01(\x0e2\x1e.flashsale.v1.ItemAvailabilityR\favailability\x12\x14\n" +
+	"\x05price\x18\v \x01(\x03R\x05price\x12%\n" +
+	"\x0eoriginal_price\x18\f \x01(\x03R\roriginalPrice\x12\x1a\n" +
+	"\bcurrency\x18\r \x01(\tR\bcurrency\x12)\n" +
+	"\x10discount_percent\x18\x0e \x01(\x05R\x0fdiscountPercent\"\xda\x01\n" +
+	"\x10ListItemsRequest\x12\x17\n" +
+	"\asale_id\x18\x01 \x01(\x03R\x06saleId\x12\x17\n" +
+	"\x04sold\x18\x02 \x01(\bH\x00R\x04sold\x88\x01\x01\x12#\n" +
+	"\ravailable_now\x18\x03 \x01(\bR\favailableNow\x12\x16\n" +
+	"\x06search\x18\x04 \x01(\tR\x06search\x12\x12\n" +
+	"\x04sort\x18\x05 \x01(\tR\x04sort\x12\x1b\n" +
+	"\tpage_size\x18\x06 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\a \x01(\tR\tpageTokenB\a\n" +
+	"\x05_sold\"e\n" +
+	"\x11ListItemsResponse\x12(\n" +
+	"\x05items\x18\x01 \x03(\v2\x12.flashsale.v1.ItemR\x05items\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"\xd7\x02\n" +
+	"\x04Sale\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x129\n" +
+	"\n" +
+	"created_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x125\n" +
+	"\bstart_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\astartAt\x121\n" +
+	"\x06end_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x05endAt\x12\x16\n" +
+	"\x06paused\x18\x05 \x01(\bR\x06paused\x12'\n" +
+	"\x0fpurchases_limit\x18\x06 \x01(\x05R\x0epurchasesLimit\x128\n" +
+	"\x18checkout_timeout_seconds\x18\a \x01(\x03R\x16checkoutTimeoutSeconds\x12\x1f\n" +
+	"\vitems_count\x18\b \x01(\x05R\n" +
+	"itemsCount\"N\n" +
+	"\x10ListSalesRequest\x12\x1b\n" +
+	"\tpage_size\x18\x01 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x02 \x01(\tR\tpageToken\"e\n" +
+	"\x11ListSalesResponse\x12(\n" +
+	"\x05sales\x18\x01 \x03(\v2\x12.flashsale.v1.SaleR\x05sales\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken*\x92\x01\n" +
+	"\x10ItemAvailability\x12!\n" +
+	"\x1dITEM_AVAILABILITY_UNSPECIFIED\x10\x00\x12\x1f\n" +
+	"\x1bITEM_AVAILABILITY_AVAILABLE\x10\x01\x12\x1e\n" +
+	"\x1aITEM_AVAILABILITY_RESERVED\x10\x02\x12\x1a\n" +
+	"\x16ITEM_AVAILABILITY_SOLD\x10\x032\x82\x03\n" +
+	"\tFlashSale\x12I\n" +
+	"\bCheckout\x12\x1d.flashsale.v1.CheckoutRequest\x1a\x1e.flashsale.v1.CheckoutResponse\x12I\n" +
+	"\bPurchase\x12\x1d.flashsale.v1.PurchaseRequest\x1a\x1e.flashsale.v1.PurchaseResponse\x12L\n" +
+	"\tListItems\x12\x1e.flashsale.v1.ListItemsRequest\x1a\x1f.flashsale.v1.ListItemsResponse\x12C\n" +
+	"\vStreamItems\x12\x1e.flashsale.v1.ListItemsRequest\x1a\x12.flashsale.v1.Item0\x01\x12L\n" +
+	"\tListSales\x12\x1e.flashsale.v1.ListSalesRequest\x1a\x1f.flashsale.v1.ListSalesResponseBCZAgithub.com/IlyushaZ/not-back-contest/api/flashsale/v1;flashsalev1b\x06proto3"
+
+var (
+	file_api_flashsale_v1_flashsale_proto_rawDescOnce sync.Once
+	file_api_flashsale_v1_flashsale_proto_rawDescData []byte
+)
+
+func file_api_flashsale_v1_flashsale_proto_rawDescGZIP() []byte {
+	file_api_flashsale_v1_flashsale_proto_rawDescOnce.Do(func() {
+		file_api_flashsale_v1_flashsale_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_api_flashsale_v1_flashsale_proto_rawDesc), len(file_api_flashsale_v1_flashsale_proto_rawDesc)))
+	})
+	return file_api_flashsale_v1_flashsale_proto_rawDescData
+}
+
+var file_api_flashsale_v1_flashsale_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_api_flashsale_v1_flashsale_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_api_flashsale_v1_flashsale_proto_goTypes = []any{
+	(ItemAvailability)(0),         // 0: flashsale.v1.ItemAvailability
+	(*CartItem)(nil),              // 1: flashsale.v1.CartItem
+	(*CheckoutRequest)(nil),       // 2: flashsale.v1.CheckoutRequest
+	(*CheckoutResponse)(nil),      // 3: flashsale.v1.CheckoutResponse
+	(*PurchaseRequest)(nil),       // 4: flashsale.v1.PurchaseRequest
+	(*PurchaseResponse)(nil),      // 5: flashsale.v1.PurchaseResponse
+	(*Order)(nil),                 // 6: flashsale.v1.Order
+	(*Item)(nil),                  // 7: flashsale.v1.Item
+	(*ListItemsRequest)(nil),      // 8: flashsale.v1.ListItemsRequest
+	(*ListItemsResponse)(nil),     // 9: flashsale.v1.ListItemsResponse
+	(*Sale)(nil),                  // 10: flashsale.v1.Sale
+	(*ListSalesRequest)(nil),      // 11: flashsale.v1.ListSalesRequest
+	(*ListSalesResponse)(nil),     // 12: flashsale.v1.ListSalesResponse
+	(*timestamppb.Timestamp)(nil), // 13: google.protobuf.Timestamp
+}
+var file_api_flashsale_v1_flashsale_proto_depIdxs = []int32{
+	1,  // 0: flashsale.v1.CheckoutRequest.items:type_name -> flashsale.v1.CartItem
+	13, // 1: flashsale.v1.CheckoutResponse.reserved_until:type_name -> google.protobuf.Timestamp
+	6,  // 2: flashsale.v1.PurchaseResponse.orders:type_name -> flashsale.v1.Order
+	13, // 3: flashsale.v1.Order.created_at:type_name -> google.protobuf.Timestamp
+	13, // 4: flashsale.v1.Item.created_at:type_name -> google.protobuf.Timestamp
+	0,  // 5: flashsale.v1.Item.availability:type_name -> flashsale.v1.ItemAvailability
+	7,  // 6: flashsale.v1.ListItemsResponse.items:type_name -> flashsale.v1.Item
+	13, // 7: flashsale.v1.Sale.created_at:type_name -> google.protobuf.Timestamp
+	13, // 8: flashsale.v1.Sale.start_at:type_name -> google.protobuf.Timestamp
+	13, // 9: flashsale.v1.Sale.end_at:type_name -> google.protobuf.Timestamp
+	10, // 10: flashsale.v1.ListSalesResponse.sales:type_name -> flashsale.v1.Sale
+	2,  // 11: flashsale.v1.FlashSale.Checkout:input_type -> flashsale.v1.CheckoutRequest
+	4,  // 12: flashsale.v1.FlashSale.Purchase:input_type -> flashsale.v1.PurchaseRequest
+	8,  // 13: flashsale.v1.FlashSale.ListItems:input_type -> flashsale.v1.ListItemsRequest
+	8,  // 14: flashsale.v1.FlashSale.StreamItems:input_type -> flashsale.v1.ListItemsRequest
+	11, // 15: flashsale.v1.FlashSale.ListSales:input_type -> flashsale.v1.ListSalesRequest
+	3,  // 16: flashsale.v1.FlashSale.Checkout:output_type -> flashsale.v1.CheckoutResponse
+	5,  // 17: flashsale.v1.FlashSale.Purchase:output_type -> flashsale.v1.PurchaseResponse
+	9,  // 18: flashsale.v1.FlashSale.ListItems:output_type -> flashsale.v1.ListItemsResponse
+	7,  // 19: flashsale.v1.FlashSale.StreamItems:output_type -> flashsale.v1.Item
+	12, // 20: flashsale.v1.FlashSale.ListSales:output_type -> flashsale.v1.ListSalesResponse
+	16, // [16:21] is the sub-list for method output_type
+	11, // [11:16] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
+}
+
+func init() { file_api_flashsale_v1_flashsale_proto_init() }
+func file_api_flashsale_v1_flashsale_proto_init() {
+	if File_api_flashsale_v1_flashsale_proto != nil {
+		return
+	}
+	file_api_flashsale_v1_flashsale_proto_msgTypes[7].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_flashsale_v1_flashsale_proto_rawDesc), len(file_api_flashsale_v1_flashsale_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_api_flashsale_v1_flashsale_proto_goTypes,
+		DependencyIndexes: file_api_flashsale_v1_flashsale_proto_depIdxs,
+		EnumInfos:         file_api_flashsale_v1_flashsale_proto_enumTypes,
+		MessageInfos:      file_api_flashsale_v1_flashsale_proto_msgTypes,
+	}.Build()
+	File_api_flashsale_v1_flashsale_proto = out.File
+	file_api_flashsale_v1_flashsale_proto_goTypes = nil
+	file_api_flashsale_v1_flashsale_proto_depIdxs = nil
+}
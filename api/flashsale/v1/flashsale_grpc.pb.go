@@ -0,0 +1,305 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: api/flashsale/v1/flashsale.proto
+
+package flashsalev1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	FlashSale_Checkout_FullMethodName    = "/flashsale.v1.FlashSale/Checkout"
+	FlashSale_Purchase_FullMethodName    = "/flashsale.v1.FlashSale/Purchase"
+	FlashSale_ListItems_FullMethodName   = "/flashsale.v1.FlashSale/ListItems"
+	FlashSale_StreamItems_FullMethodName = "/flashsale.v1.FlashSale/StreamItems"
+	FlashSale_ListSales_FullMethodName   = "/flashsale.v1.FlashSale/ListSales"
+)
+
+// FlashSaleClient is the client API for FlashSale service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// FlashSale is the API for internal services. It goes through the same limits as HTTP API.
+//
+// Errors are reported with status codes:
+//   - INVALID_ARGUMENT if request is malformed, e.g. code or page token is invalid;
+//   - NOT_FOUND if there is no such reservation (or it has expired);
+//   - FAILED_PRECONDITION if item is unavailable for checkout or payment is declined;
+//   - RESOURCE_EXHAUSTED if user has exceeded his purchases limit;
+//   - DEADLINE_EXCEEDED if deadline has passed or payment provider hasn't responded in time.
+type FlashSaleClient interface {
+	// Checkout reserves the units of the items with a single code: either all of them or none.
+	Checkout(ctx context.Context, in *CheckoutRequest, opts ...grpc.CallOption) (*CheckoutResponse, error)
+	// Purchase buys all the units reserved with the code and returns the orders created, one per item.
+	Purchase(ctx context.Context, in *PurchaseRequest, opts ...grpc.CallOption) (*PurchaseResponse, error)
+	// ListItems returns a page of the items matching the filter.
+	ListItems(ctx context.Context, in *ListItemsRequest, opts ...grpc.CallOption) (*ListItemsResponse, error)
+	// StreamItems streams all the items matching the filter, page_token and page_size are ignored.
+	StreamItems(ctx context.Context, in *ListItemsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Item], error)
+	// ListSales returns a page of sales, the latest first.
+	ListSales(ctx context.Context, in *ListSalesRequest, opts ...grpc.CallOption) (*ListSalesResponse, error)
+}
+
+type flashSaleClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFlashSaleClient(cc grpc.ClientConnInterface) FlashSaleClient {
+	return &flashSaleClient{cc}
+}
+
+func (c *flashSaleClient) Checkout(ctx context.Context, in *CheckoutRequest, opts ...grpc.CallOption) (*CheckoutResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CheckoutResponse)
+	err := c.cc.Invoke(ctx, FlashSale_Checkout_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *flashSaleClient) Purchase(ctx context.Context, in *PurchaseRequest, opts ...grpc.CallOption) (*PurchaseResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PurchaseResponse)
+	err := c.cc.Invoke(ctx, FlashSale_Purchase_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *flashSaleClient) ListItems(ctx context.Context, in *ListItemsRequest, opts ...grpc.CallOption) (*ListItemsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListItemsResponse)
+	err := c.cc.Invoke(ctx, FlashSale_ListItems_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *flashSaleClient) StreamItems(ctx context.Context, in *ListItemsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Item], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FlashSale_ServiceDesc.Streams[0], FlashSale_StreamItems_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListItemsRequest, Item]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FlashSale_StreamItemsClient = grpc.ServerStreamingClient[Item]
+
+func (c *flashSaleClient) ListSales(ctx context.Context, in *ListSalesRequest, opts ...grpc.CallOption) (*ListSalesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSalesResponse)
+	err := c.cc.Invoke(ctx, FlashSale_ListSales_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FlashSaleServer is the server API for FlashSale service.
+// All implementations must embed UnimplementedFlashSaleServer
+// for forward compatibility.
+//
+// FlashSale is the API for internal services. It goes through the same limits as HTTP API.
+//
+// Errors are reported with status codes:
+//   - INVALID_ARGUMENT if request is malformed, e.g. code or page token is invalid;
+//   - NOT_FOUND if there is no such reservation (or it has expired);
+//   - FAILED_PRECONDITION if item is unavailable for checkout or payment is declined;
+//   - RESOURCE_EXHAUSTED if user has exceeded his purchases limit;
+//   - DEADLINE_EXCEEDED if deadline has passed or payment provider hasn't responded in time.
+type FlashSaleServer interface {
+	// Checkout reserves the units of the items with a single code: either all of them or none.
+	Checkout(context.Context, *CheckoutRequest) (*CheckoutResponse, error)
+	// Purchase buys all the units reserved with the code and returns the orders created, one per item.
+	Purchase(context.Context, *PurchaseRequest) (*PurchaseResponse, error)
+	// ListItems returns a page of the items matching the filter.
+	ListItems(context.Context, *ListItemsRequest) (*ListItemsResponse, error)
+	// StreamItems streams all the items matching the filter, page_token and page_size are ignored.
+	StreamItems(*ListItemsRequest, grpc.ServerStreamingServer[Item]) error
+	// ListSales returns a page of sales, the latest first.
+	ListSales(context.Context, *ListSalesRequest) (*ListSalesResponse, error)
+	mustEmbedUnimplementedFlashSaleServer()
+}
+
+// UnimplementedFlashSaleServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFlashSaleServer struct{}
+
+func (UnimplementedFlashSaleServer) Checkout(context.Context, *CheckoutRequest) (*CheckoutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Checkout not implemented")
+}
+func (UnimplementedFlashSaleServer) Purchase(context.Context, *PurchaseRequest) (*PurchaseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Purchase not implemented")
+}
+func (UnimplementedFlashSaleServer) ListItems(context.Context, *ListItemsRequest) (*ListItemsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListItems not implemented")
+}
+func (UnimplementedFlashSaleServer) StreamItems(*ListItemsRequest, grpc.ServerStreamingServer[Item]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamItems not implemented")
+}
+func (UnimplementedFlashSaleServer) ListSales(context.Context, *ListSalesRequest) (*ListSalesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSales not implemented")
+}
+func (UnimplementedFlashSaleServer) mustEmbedUnimplementedFlashSaleServer() {}
+func (UnimplementedFlashSaleServer) testEmbeddedByValue()                   {}
+
+// UnsafeFlashSaleServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FlashSaleServer will
+// result in compilation errors.
+type UnsafeFlashSaleServer interface {
+	mustEmbedUnimplementedFlashSaleServer()
+}
+
+func RegisterFlashSaleServer(s grpc.ServiceRegistrar, srv FlashSaleServer) {
+	// If the following call pancis, it indicates UnimplementedFlashSaleServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&FlashSale_ServiceDesc, srv)
+}
+
+func _FlashSale_Checkout_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckoutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FlashSaleServer).Checkout(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FlashSale_Checkout_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FlashSaleServer).Checkout(ctx, req.(*CheckoutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FlashSale_Purchase_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurchaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FlashSaleServer).Purchase(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FlashSale_Purchase_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FlashSaleServer).Purchase(ctx, req.(*PurchaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FlashSale_ListItems_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListItemsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FlashSaleServer).ListItems(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FlashSale_ListItems_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FlashSaleServer).ListItems(ctx, req.(*ListItemsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FlashSale_StreamItems_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListItemsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FlashSaleServer).StreamItems(m, &grpc.GenericServerStream[ListItemsRequest, Item]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FlashSale_StreamItemsServer = grpc.ServerStreamingServer[Item]
+
+func _FlashSale_ListSales_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSalesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FlashSaleServer).ListSales(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FlashSale_ListSales_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FlashSaleServer).ListSales(ctx, req.(*ListSalesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// FlashSale_ServiceDesc is the grpc.ServiceDesc for FlashSale service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FlashSale_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "flashsale.v1.FlashSale",
+	HandlerType: (*FlashSaleServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Checkout",
+			Handler:    _FlashSale_Checkout_Handler,
+		},
+		{
+			MethodName: "Purchase",
+			Handler:    _FlashSale_Purchase_Handler,
+		},
+		{
+			MethodName: "ListItems",
+			Handler:    _FlashSale_ListItems_Handler,
+		},
+		{
+			MethodName: "ListSales",
+			Handler:    _FlashSale_ListSales_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamItems",
+			Handler:       _FlashSale_StreamItems_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "api/flashsale/v1/flashsale.proto",
+}
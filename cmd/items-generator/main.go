@@ -25,7 +25,7 @@ var (
 	items      = []string{"Phone", "Laptop", "Watch", "Headphones", "Camera", "Tablet", "Speaker", "Keyboard", "Mouse", "Monitor"}
 )
 
-// this should run by cron every hour in 1 instance. I should have done the workers which can run in multiple instances and synchronize, but im too lazy.
+// this should run by cron every sale duration (hour by default) in 1 instance. I should have done the workers which can run in multiple instances and synchronize, but im too lazy.
 func main() {
 	t0 := time.Now()
 	defer func() { log.Printf("Items generated. Elapsed: %s", time.Since(t0)) }()
@@ -44,9 +44,24 @@ func main() {
 func generate(db *sql.DB) error {
 	now := time.Now()
 
+	first := now.Truncate(cfg.SaleDuration)
+	if cfg.SaleStart != "" {
+		var err error
+
+		first, err = time.Parse(time.RFC3339, cfg.SaleStart)
+		if err != nil {
+			return fmt.Errorf("can't parse sale start: %w", err)
+		}
+	}
+
+	interval := cfg.SalesInterval
+	if interval == 0 {
+		interval = cfg.SaleDuration
+	}
+
 	for i := 0; i < cfg.SalesCount; i++ {
-		start := now.Truncate(time.Hour)
-		end := start.Add(model.SaleDuration)
+		start := first.Add(time.Duration(i) * interval)
+		end := start.Add(cfg.SaleDuration)
 
 		err := database.WithTx(db, func(tx *sql.Tx) error {
 			const saleExists = `
@@ -68,33 +83,49 @@ func generate(db *sql.DB) error {
 			}
 
 			const insertSale = `
-				insert into sales (start_at, end_at, created_at)
-				values ($1, $2, $3)
+				insert into sales (start_at, end_at, created_at, purchases_limit, checkout_timeout, items_count)
+				values ($1, $2, $3, $4, make_interval(secs => $5), $6)
 				returning id
 			`
 
 			var saleID int
 
-			if err := tx.QueryRow(insertSale, start, end, now).Scan(&saleID); err != nil {
+			err := tx.QueryRow(insertSale, start, end, now, cfg.PurchasesLimit, cfg.CheckoutTimeout.Seconds(), cfg.ItemsPerSale).Scan(&saleID)
+			if err != nil {
 				return fmt.Errorf("can't insert sale: %w", err)
 			}
 
-			stmt, err := tx.Prepare(`insert into items (sale_id, name, created_at, sale_start, sale_end) values ($1, $2, $3, $4, $5)`)
-			if err != nil {
-				return fmt.Errorf("can't prepare stmt for inserting item: %w", err)
+			var (
+				names          = make([]string, 0, cfg.ItemsPerSale)
+				prices         = make([]int64, 0, cfg.ItemsPerSale)
+				originalPrices = make([]int64, 0, cfg.ItemsPerSale)
+			)
+
+			for range cfg.ItemsPerSale {
+				price, originalPrice := generatePrice()
+
+				names = append(names, generateItemName())
+				prices = append(prices, price)
+				originalPrices = append(originalPrices, originalPrice)
 			}
 
-			for j := 0; j < cfg.ItemsPerSale; j++ {
-				item := generateItem(saleID, start, end, now)
-				if _, err := stmt.Exec(item.SaleID, item.Name, now, item.SaleStart, item.SaleEnd); err != nil {
-					return fmt.Errorf("can't insert item: %w", err)
-				}
+			// all the items are inserted by single query, which is much faster than one by one
+			const insertItems = `
+				insert into items (
+					sale_id, name, price, original_price, currency,
+					created_at, sale_start, sale_end, quantity, available_quantity
+				)
+				select $1, name, price, original_price, $5, $6, $7, $8, $9, $9
+				from unnest($2::text[], $3::bigint[], $4::bigint[]) as t(name, price, original_price)
+			`
 
-				if (j+1)%100 == 0 {
-					log.Printf("Inserted %d items for sale #%d\n", j+1, i+1)
-				}
+			_, err = tx.Exec(insertItems, saleID, names, prices, originalPrices, model.DefaultCurrency, now, start, end, cfg.ItemQuantity)
+			if err != nil {
+				return fmt.Errorf("can't insert items: %w", err)
 			}
 
+			log.Printf("Inserted %d items for sale #%d\n", len(names), i+1)
+
 			return nil
 		})
 		if err != nil {
@@ -109,24 +140,25 @@ func generate(db *sql.DB) error {
 			return fmt.Errorf("can't add sale to database: %w", err)
 		}
 
-		now = now.Add(time.Hour) // next sale will be for the next item
-
 		log.Printf("Sale #%d added\n", i+1)
 	}
 
 	return nil
 }
 
-func generateItem(saleID int, saleStart, saleEnd, createdAt time.Time) *model.Item {
+func generateItemName() string {
 	adj := adjectives[rand.Intn(len(adjectives))]
 	category := categories[rand.Intn(len(categories))]
 	item := items[rand.Intn(len(items))]
 
-	return &model.Item{
-		Base:      model.Base{CreatedAt: createdAt},
-		SaleID:    saleID,
-		SaleStart: saleStart,
-		SaleEnd:   saleEnd,
-		Name:      fmt.Sprintf("%s %s %s", adj, category, item),
-	}
+	return fmt.Sprintf("%s %s %s", adj, category, item)
+}
+
+// generatePrice returns price within the sale and original price in cents.
+// Original price is from $10 to $1000, discount is from 10% to 70%.
+func generatePrice() (price, originalPrice int64) {
+	originalPrice = (10 + rand.Int63n(991)) * 100
+	discount := 10 + rand.Int63n(61)
+
+	return originalPrice * (100 - discount) / 100, originalPrice
 }
@@ -6,15 +6,22 @@ import (
 	"fmt"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/IlyushaZ/not-back-contest/pkg/cache"
 	"github.com/IlyushaZ/not-back-contest/pkg/config"
 	"github.com/IlyushaZ/not-back-contest/pkg/database"
+	"github.com/IlyushaZ/not-back-contest/pkg/events"
+	"github.com/IlyushaZ/not-back-contest/pkg/idempotency"
 	"github.com/IlyushaZ/not-back-contest/pkg/limiter"
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+	"github.com/IlyushaZ/not-back-contest/pkg/payment"
 	"github.com/IlyushaZ/not-back-contest/pkg/server"
+	"github.com/IlyushaZ/not-back-contest/pkg/server/rpc"
 	"github.com/IlyushaZ/not-back-contest/pkg/service"
 	"github.com/redis/go-redis/v9"
 )
@@ -33,6 +40,16 @@ func main() {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: parseLogLevel(cfg.LogLevel)}))
 	slog.SetDefault(logger)
 
+	codeKeys, err := model.ParseCodeKeys(cfg.CodeKeys)
+	if err != nil {
+		log.Fatalf("### Can't parse code keys: %v", err)
+	}
+
+	signer, err := model.NewHMACCodeSigner(codeKeys, cfg.AcceptLegacyCodes)
+	if err != nil {
+		log.Fatalf("### Can't init code signer, set --codeKeys: %v", err)
+	}
+
 	db, closeDB, err := database.New(cfg.PostgresAddr, cfg.PostgresDB, cfg.PostgresUser, cfg.PostgresPassword)
 	if err != nil {
 		log.Fatalf("### Can't init database: %v", err)
@@ -45,9 +62,63 @@ func main() {
 	}
 	defer closeRedis()
 
-	itemSvc, saleSvc := composeServices(db, redis, cfg)
+	codeGen, err := model.NewCodeGenerator(cfg.CodeGenerator, cfg.CodeLen, cfg.CodeAlphabet)
+	if err != nil {
+		log.Fatalf("### Can't create code generator: %v", err)
+	}
+
+	var payments payment.Provider
+	if cfg.PaymentProvider != "" {
+		payments, err = payment.New(cfg.PaymentProvider, cfg.FakePaymentOutcome)
+		if err != nil {
+			log.Fatalf("### Can't create payment provider: %v", err)
+		}
+	} else {
+		slog.Warn("No payment provider configured, purchases are made without payment")
+	}
+
+	var bus *events.Bus
+	if cfg.StreamEvents {
+		bus = events.NewBus(redis, cfg.EventsHistory, cfg.EventsBuffer)
+	}
+
+	var idem *idempotency.Store
+	if cfg.IdempotencyTTL > 0 {
+		idem = &idempotency.Store{
+			Redis: &idempotency.RedisBackend{Redis: redis},
+			DB:    &database.IdempotencyDatabase{DB: db},
+			TTL:   cfg.IdempotencyTTL,
+			Wait:  cfg.IdempotencyWait,
+		}
+	}
+
+	itemSvc, saleSvc, reaper := composeServices(db, redis, codeGen, signer, payments, bus, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if bus != nil {
+		go bus.Run(ctx)
+	}
+
+	if idem != nil {
+		go idem.Run(ctx)
+	}
+
+	if cfg.ReaperInterval > 0 {
+		go reaper.Run(ctx)
+	}
+
+	if cfg.AdminToken == "" {
+		slog.Warn("No admin token configured, admin routes are disabled")
+	}
 
-	srv, err := server.New(cfg.ListenAddr, itemSvc, saleSvc)
+	var wsOrigins []string
+	if cfg.WSOrigins != "" {
+		wsOrigins = strings.Split(cfg.WSOrigins, ",")
+	}
+
+	srv, err := server.New(cfg.ListenAddr, cfg.AdminToken, itemSvc, saleSvc, signer, bus, idem, wsOrigins, cfg.ExpiryWarning)
 	if err != nil {
 		log.Fatalf("### Can't create server: %v", err)
 	}
@@ -59,32 +130,99 @@ func main() {
 	}()
 	slog.Info(fmt.Sprintf("HTTP server listening at %s", srv.Addr))
 
+	grpcSrv := rpc.New(itemSvc, saleSvc, signer)
+
+	if cfg.GRPCListenAddr != "" {
+		lis, err := net.Listen("tcp", cfg.GRPCListenAddr)
+		if err != nil {
+			log.Fatalf("### Can't listen for gRPC: %v", err)
+		}
+
+		go func() {
+			if err := grpcSrv.Serve(lis); err != nil {
+				log.Fatalf("### Can't serve gRPC: %v", err)
+			}
+		}()
+		slog.Info(fmt.Sprintf("gRPC server listening at %s", lis.Addr()))
+	}
+
 	<-shutdown
 
-	ctx, cancel := context.WithTimeout(context.Background(), gracefulTimeout)
-	defer cancel()
+	cancel()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), gracefulTimeout)
+	defer shutdownCancel()
 
-	srv.Shutdown(ctx)
+	// GracefulStop waits for streams as well, so it's bounded by the same timeout
+	stopped := make(chan struct{})
+	go func() {
+		grpcSrv.GracefulStop()
+		close(stopped)
+	}()
+
+	srv.Shutdown(shutdownCtx)
+
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		grpcSrv.Stop()
+	}
 }
 
-func composeServices(db *sql.DB, redis *redis.Client, cfg *config.Config) (item service.Item, sale service.Sale) {
+func composeServices(db *sql.DB, redis *redis.Client, codeGen model.CodeGenerator, signer model.CodeSigner, payments payment.Provider, bus *events.Bus, cfg *config.Config) (item service.Item, sale service.Sale, reaper *service.Reaper) {
 	idb, _ := database.NewItemDatabase(db)
 
+	sdb := &database.SaleDatabase{DB: db}
+	sales := service.NewSaleCache(idb, sdb, cfg.SaleCacheTTL)
+
 	item = &service.ItemGeneric{
-		idb,
-		database.NewCheckoutBatchingDatabase(db, cfg.CheckoutsBatchSize, cfg.CheckoutsFlushInterval),
-		cfg.CheckoutTimeout,
+		ItemRepository:        idb,
+		CheckoutRepository:    database.NewCheckoutBatchingDatabase(db, cfg.CheckoutsBatchSize, cfg.CheckoutsFlushInterval),
+		Sales:                 sales,
+		CheckoutExtension:     cfg.CheckoutExtension,
+		MaxCheckoutExtensions: cfg.MaxCheckoutExtensions,
+		CodeGenerator:         codeGen,
+		CodeSigner:            signer,
+		Payments:              payments,
+		PaymentTimeout:        cfg.PaymentTimeout,
+		Events:                bus,
 	}
 
 	if cfg.CacheCheckouts {
-		item = service.NewItemCaching(item, redis, cfg.CheckoutTimeout, cfg.ItemsPerSale)
+		item = service.NewItemCaching(item, redis, sales, cfg.UnavailableTTL)
 	}
 
-	item = &service.ItemLimiting{item, &limiter.Limiter{redis, cfg.PurchasesLimit}, cfg.LimiterFailOpen}
-	item = &service.ItemLogging{item}
+	lim := &limiter.Limiter{Redis: redis}
+
+	item = &service.ItemLimiting{
+		Item:         item,
+		Limiter:      lim,
+		Sales:        sales,
+		FailOpen:     cfg.LimiterFailOpen,
+		MaxExtension: cfg.CheckoutExtension * time.Duration(cfg.MaxCheckoutExtensions),
+		CodeSigner:   signer,
+	}
+	item = &service.ItemLogging{Item: item}
 
 	sale = &service.SaleGeneric{
-		&database.SaleDatabase{db},
+		SaleRepository: sdb,
+		DefaultSettings: model.SaleSettings{
+			PurchasesLimit:  cfg.PurchasesLimit,
+			CheckoutTimeout: model.Duration(cfg.CheckoutTimeout),
+		},
+	}
+
+	if cfg.SaleStatsTTL > 0 {
+		sale = service.NewSaleCaching(sale, cfg.SaleStatsTTL)
+	}
+
+	reaper = &service.Reaper{
+		ItemRepository: idb,
+		Interval:       cfg.ReaperInterval,
+		BatchSize:      cfg.ReaperBatchSize,
+		Events:         bus,
+		Sales:          sales,
+		Limiter:        lim,
 	}
 
 	return
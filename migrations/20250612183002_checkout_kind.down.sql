@@ -0,0 +1,5 @@
+begin;
+
+alter table checkouts drop column if exists kind;
+
+commit;
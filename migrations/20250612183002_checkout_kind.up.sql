@@ -0,0 +1,5 @@
+begin;
+
+alter table checkouts add column kind text not null default 'checkout';
+
+commit;
@@ -0,0 +1,5 @@
+begin;
+
+alter table items drop column if exists extensions;
+
+commit;
@@ -0,0 +1,5 @@
+begin;
+
+alter table items add column extensions int not null default 0;
+
+commit;
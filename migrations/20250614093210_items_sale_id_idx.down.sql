@@ -0,0 +1,5 @@
+begin;
+
+drop index if exists items_sale_id_not_sold_idx;
+
+commit;
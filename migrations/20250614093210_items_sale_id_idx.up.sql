@@ -0,0 +1,5 @@
+begin;
+
+create index items_sale_id_not_sold_idx on items (sale_id) where not sold;
+
+commit;
@@ -0,0 +1,5 @@
+begin;
+
+drop index if exists items_reserved_until_not_sold_idx;
+
+commit;
@@ -0,0 +1,5 @@
+begin;
+
+create index items_reserved_until_not_sold_idx on items (reserved_until) where not sold;
+
+commit;
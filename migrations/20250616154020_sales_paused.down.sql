@@ -0,0 +1,6 @@
+begin;
+
+alter table items drop column if exists sale_paused;
+alter table sales drop column if exists paused;
+
+commit;
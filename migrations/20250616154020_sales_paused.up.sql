@@ -0,0 +1,8 @@
+begin;
+
+alter table sales add column paused boolean not null default false;
+
+-- denormalized the same way as sale_start and sale_end
+alter table items add column sale_paused boolean not null default false;
+
+commit;
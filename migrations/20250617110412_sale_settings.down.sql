@@ -0,0 +1,7 @@
+begin;
+
+alter table sales drop column if exists items_count;
+alter table sales drop column if exists checkout_timeout;
+alter table sales drop column if exists purchases_limit;
+
+commit;
@@ -0,0 +1,10 @@
+begin;
+
+alter table sales add column purchases_limit int not null default 10;
+alter table sales add column checkout_timeout interval not null default '30 seconds';
+alter table sales add column items_count int not null default 10000;
+
+update sales s
+set items_count = (select count(*) from items i where i.sale_id = s.id);
+
+commit;
@@ -0,0 +1,33 @@
+begin;
+
+alter table checkouts drop column if exists quantity;
+
+alter table items add column reserved_by int;
+alter table items add column reserved_until timestamptz;
+alter table items add column code text;
+alter table items add column extensions int not null default 0;
+
+-- only the latest active reservation of each item can be put back
+update items i
+set reserved_by = r.user_id, reserved_until = r.reserved_until, code = r.code, extensions = r.extensions
+from (
+    select distinct on (item_id) item_id, user_id, reserved_until, code, extensions
+    from reservations
+    where status = 'active'
+    order by item_id, reserved_until desc
+) r
+where i.id = r.item_id;
+
+create index items_reserved_until_not_sold_idx on items (reserved_until) where not sold;
+
+drop index if exists items_sale_id_available_idx;
+create index items_sale_id_not_sold_idx on items (sale_id) where not sold;
+
+drop table if exists reservations;
+
+alter table items drop constraint if exists items_available_quantity_check;
+alter table items drop column if exists sold_quantity;
+alter table items drop column if exists available_quantity;
+alter table items drop column if exists quantity;
+
+commit;
@@ -0,0 +1,54 @@
+begin;
+
+-- item is a SKU now: it has a stock of units which are reserved and sold independently
+alter table items add column quantity int not null default 1;
+alter table items add column available_quantity int not null default 1;
+alter table items add column sold_quantity int not null default 0;
+
+alter table items add constraint items_available_quantity_check check (available_quantity >= 0);
+
+create table reservations (
+    id serial primary key,
+    created_at timestamptz not null,
+    item_id int not null references items (id) on delete cascade,
+    user_id int not null,
+    quantity int not null check (quantity > 0),
+    code text not null,
+    reserved_until timestamptz not null,
+    extensions int not null default 0,
+    status text not null default 'active' -- active, purchased, cancelled or expired
+);
+
+create index reservations_user_id_code_active_idx on reservations (user_id, code) where status = 'active';
+create index reservations_reserved_until_active_idx on reservations (reserved_until) where status = 'active';
+
+-- reservations which are still held are moved as is (the expired ones are released by reaper),
+-- sold items keep their single unit sold
+insert into reservations (created_at, item_id, user_id, quantity, code, reserved_until, extensions)
+select now(), id, reserved_by, 1, code, reserved_until, extensions
+from items
+where not sold
+  and reserved_by is not null
+  and code is not null
+  and reserved_until is not null;
+
+update items
+set available_quantity = 0
+where sold or (reserved_by is not null and code is not null and reserved_until is not null);
+
+update items
+set sold_quantity = 1
+where sold;
+
+-- sold means that the whole stock is sold out now
+drop index if exists items_sale_id_not_sold_idx;
+create index items_sale_id_available_idx on items (sale_id) where available_quantity > 0;
+
+alter table items drop column reserved_by;
+alter table items drop column reserved_until;
+alter table items drop column code;
+alter table items drop column extensions;
+
+alter table checkouts add column quantity int not null default 1;
+
+commit;
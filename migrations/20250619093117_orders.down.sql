@@ -0,0 +1,10 @@
+begin;
+
+drop table if exists orders;
+
+alter table items drop column if exists discount_percent;
+alter table items drop column if exists currency;
+alter table items drop column if exists original_price;
+alter table items drop column if exists price;
+
+commit;
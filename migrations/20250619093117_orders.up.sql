@@ -0,0 +1,29 @@
+begin;
+
+-- prices are kept in minor units (e.g. cents) of the currency
+alter table items add column price bigint not null default 0 check (price >= 0);
+alter table items add column original_price bigint not null default 0 check (original_price >= 0);
+alter table items add column currency text not null default 'USD';
+alter table items add column discount_percent int generated always as (
+    case when original_price > 0 then ((original_price - price) * 100 / original_price)::int else 0 end
+) stored;
+
+-- price snapshot is taken on purchase, so later changes of items don't affect orders
+create table orders (
+    id serial primary key,
+    created_at timestamptz not null,
+    user_id int not null,
+    item_id int not null references items (id),
+    sale_id int not null references sales (id),
+    reservation_id int not null references reservations (id),
+    quantity int not null check (quantity > 0),
+    price bigint not null,
+    original_price bigint not null,
+    currency text not null,
+    code text not null -- orders of the same cart share the code
+);
+
+create index orders_user_id_idx on orders (user_id);
+create index orders_sale_id_idx on orders (sale_id);
+
+commit;
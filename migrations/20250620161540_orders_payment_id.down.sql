@@ -0,0 +1,5 @@
+begin;
+
+alter table orders drop column if exists payment_id;
+
+commit;
@@ -0,0 +1,6 @@
+begin;
+
+-- id of the payment in the provider, null if purchase was made without payment step
+alter table orders add column payment_id text;
+
+commit;
@@ -0,0 +1,7 @@
+begin;
+
+drop table if exists refunds;
+
+alter table orders drop column if exists refunded_quantity;
+
+commit;
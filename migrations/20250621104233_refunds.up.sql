@@ -0,0 +1,19 @@
+begin;
+
+alter table orders add column refunded_quantity int not null default 0;
+alter table orders add constraint orders_refunded_quantity_check check (refunded_quantity between 0 and quantity);
+
+-- audit of refunds, order may be refunded in several parts
+create table refunds (
+    id serial primary key,
+    created_at timestamptz not null,
+    order_id int not null references orders (id),
+    quantity int not null check (quantity > 0),
+    amount bigint not null, -- in minor units of the order's currency
+    restocked boolean not null, -- whether the units were put back on sale
+    reason text not null default ''
+);
+
+create index refunds_order_id_idx on refunds (order_id);
+
+commit;
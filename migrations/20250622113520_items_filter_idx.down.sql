@@ -0,0 +1,8 @@
+begin;
+
+drop index if exists items_sale_end_available_idx;
+drop index if exists items_sale_id_price_idx;
+drop index if exists items_sale_id_id_idx;
+drop index if exists items_name_trgm_idx;
+
+commit;
@@ -0,0 +1,14 @@
+begin;
+
+-- name is searched by substring, which only trigram index can speed up
+create extension if not exists pg_trgm;
+create index items_name_trgm_idx on items using gin (name gin_trgm_ops);
+
+-- listing of the sale sorted by id or price
+create index items_sale_id_id_idx on items (sale_id, id);
+create index items_sale_id_price_idx on items (sale_id, price, id);
+
+-- items which can be checked out at the moment, regardless of the sale
+create index items_sale_end_available_idx on items (sale_end) where available_quantity > 0;
+
+commit;
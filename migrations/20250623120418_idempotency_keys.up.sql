@@ -0,0 +1,15 @@
+begin;
+
+-- responses to requests made with idempotency keys, used while Redis is unavailable
+create table idempotency_keys (
+    key text primary key,
+    fingerprint text not null, -- hash of the request the key was used for
+    status int, -- null while the request is in progress
+    header jsonb,
+    body bytea,
+    expires_at timestamptz not null
+);
+
+create index idempotency_keys_expires_at_idx on idempotency_keys (expires_at);
+
+commit;
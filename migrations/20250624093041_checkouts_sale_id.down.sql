@@ -0,0 +1,7 @@
+begin;
+
+delete from checkouts where item_id is null;
+alter table checkouts drop column if exists sale_id;
+alter table checkouts alter column item_id set not null;
+
+commit;
@@ -0,0 +1,7 @@
+begin;
+
+-- failed checkouts of any item of the sale are not bound to a particular item
+alter table checkouts alter column item_id drop not null;
+alter table checkouts add column sale_id int references sales (id) on delete cascade;
+
+commit;
@@ -0,0 +1,6 @@
+begin;
+
+drop index if exists reservations_reserved_until_paying_idx;
+update reservations set status = 'active' where status = 'paying';
+
+commit;
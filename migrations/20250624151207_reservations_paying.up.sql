@@ -0,0 +1,7 @@
+begin;
+
+-- reservations are put on hold with 'paying' status while payment is made on purchase,
+-- the ones left on hold by failed instances are flagged as 'payment_unknown' by reaper
+create index reservations_reserved_until_paying_idx on reservations (reserved_until) where status = 'paying';
+
+commit;
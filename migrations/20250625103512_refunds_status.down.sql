@@ -0,0 +1,6 @@
+begin;
+
+drop index if exists refunds_pending_idx;
+alter table refunds drop column if exists status;
+
+commit;
@@ -0,0 +1,9 @@
+begin;
+
+-- refund is recorded as pending before money is returned by payment provider and completed after,
+-- the ones left pending have unknown outcome and must be reconciled with provider
+alter table refunds add column status text not null default 'completed'; -- pending, completed or failed
+
+create index refunds_pending_idx on refunds (created_at) where status = 'pending';
+
+commit;
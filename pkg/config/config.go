@@ -8,8 +8,10 @@ import (
 )
 
 type Config struct {
-	LogLevel   string
-	ListenAddr string
+	LogLevel       string
+	ListenAddr     string
+	GRPCListenAddr string // empty disables gRPC API
+	AdminToken     string // token required to access /admin routes
 
 	PostgresAddr     string // Postgres address in host[:port] format
 	PostgresDB       string
@@ -21,16 +23,49 @@ type Config struct {
 	RedisPassword string // Redis password
 
 	LimiterFailOpen bool
-	CacheCheckouts  bool // whether to save and check checkout info to redis
-	PurchasesLimit  int
-	CheckoutTimeout time.Duration
+	CacheCheckouts  bool          // whether to save and check checkout info to redis
+	UnavailableTTL  time.Duration // how long item is considered unavailable after failed checkout when CacheCheckouts is set
+	PurchasesLimit  int           // default for new sales
+	SaleCacheTTL    time.Duration // how often sales cached in-process are refreshed
+	SaleStatsTTL    time.Duration // how long counts of units of sales are cached, zero disables caching
+	CheckoutTimeout time.Duration // default for new sales
+
+	CheckoutExtension     time.Duration
+	MaxCheckoutExtensions int
+
+	CodeKeys          string // keys used to sign checkout codes in "id1:secret1,id2:secret2" format
+	AcceptLegacyCodes bool
+	CodeGenerator     string // "random" or "unique"
+	CodeLen           int
+	CodeAlphabet      string
 
 	CheckoutsBatchSize     int
 	CheckoutsFlushInterval time.Duration
 
+	ReaperInterval  time.Duration // zero disables releasing of expired reservations
+	ReaperBatchSize int
+
+	PaymentProvider    string // "fake" or empty to purchase without payment
+	FakePaymentOutcome string // "succeed", "decline" or "timeout"
+	PaymentTimeout     time.Duration
+
+	StreamEvents  bool // whether to serve stream of changes of items' stock
+	EventsHistory int  // number of the latest events kept per sale to resume streams from
+	EventsBuffer  int  // number of events queued for a subscriber before it's dropped
+
+	IdempotencyTTL  time.Duration // how long responses to requests with Idempotency-Key are kept, zero disables keys
+	IdempotencyWait time.Duration // how long request waits for another one with the same key
+
+	WSOrigins     string        // comma-separated host patterns of origins allowed to open WebSocket connections
+	ExpiryWarning time.Duration // how long before reservation expires WebSocket clients are warned
+
 	// Items generator params
-	SalesCount   int
-	ItemsPerSale int
+	SalesCount    int
+	ItemsPerSale  int
+	ItemQuantity  int    // units in stock of each item
+	SaleStart     string // RFC 3339 start of the first sale, current time truncated to SaleDuration if empty
+	SaleDuration  time.Duration
+	SalesInterval time.Duration // time between starts of consecutive sales, sales overlap if it's less than SaleDuration
 }
 
 func New() *Config {
@@ -38,6 +73,9 @@ func New() *Config {
 
 	flag.StringVar(&c.LogLevel, "logLevel", LookupEnvString("LOG_LEVEL", "DEBUG"), "Set log level: DEBUG, INFO, WARNING, ERROR.")
 	flag.StringVar(&c.ListenAddr, "listenAddr", LookupEnvString("LISTEN_ADDR", ":8000"), `Address in form of "[host]:port" that HTTP server should be listening on.`)
+	flag.StringVar(&c.GRPCListenAddr, "grpcListenAddr", LookupEnvString("GRPC_LISTEN_ADDR", ":9000"), `Address in form of "[host]:port" that gRPC server should be listening on. Set to empty to disable gRPC API.`)
+
+	flag.StringVar(&c.AdminToken, "adminToken", LookupEnvString("ADMIN_TOKEN", ""), "Bearer token required to access /admin routes. If not set, admin routes are disabled.")
 
 	flag.StringVar(&c.PostgresAddr, "postgresAddr", LookupEnvString("POSTGRES_ADDR", "127.0.0.1:5432"), "Set PostgreSQL address as host:port, where port is optional (without TLS).")
 	flag.StringVar(&c.PostgresDB, "postgresDB", LookupEnvString("POSTGRES_DB", "notbackcontest"), "Set PostgreSQL DB.")
@@ -50,14 +88,47 @@ func New() *Config {
 
 	flag.BoolVar(&c.LimiterFailOpen, "limiterFailOpen", LookupEnvBool("LIMITER_FAIL_OPEN", false), "Set to make limiter allow request if failed to check limits.")
 	flag.BoolVar(&c.CacheCheckouts, "cacheCheckouts", LookupEnvBool("CACHE_CHECKOUTS", false), "Set to cache limiter info. May be useful when single item is requested many times.")
-	flag.IntVar(&c.PurchasesLimit, "purchasesLimit", LookupEnvInt("PURCHASES_LIMIT", 10), "Number of purchases that single user can make within one sale.")
-	flag.DurationVar(&c.CheckoutTimeout, "checkoutTimeout", LookupEnvDuration("CHECKOKUT_TIMEOUT", model.DefaultCheckoutTimeout), "How long item can be reserved by user in format that can be parsed by go's time.ParseDuration.")
+	flag.DurationVar(&c.UnavailableTTL, "unavailableTTL", LookupEnvDuration("UNAVAILABLE_TTL", time.Second), "How long item is considered unavailable after checkout failed because of not enough units (only with cacheCheckouts).")
+	flag.IntVar(&c.PurchasesLimit, "purchasesLimit", LookupEnvInt("PURCHASES_LIMIT", 10), "Number of purchases that single user can make within one sale. Used for new sales which don't set their own limit.")
+	flag.DurationVar(&c.SaleCacheTTL, "saleCacheTTL", LookupEnvDuration("SALE_CACHE_TTL", 10*time.Second), "How often sales cached in-process should be refreshed.")
+	flag.DurationVar(&c.SaleStatsTTL, "saleStatsTTL", LookupEnvDuration("SALE_STATS_TTL", time.Second), "How long counts of available, reserved and sold units of sales are cached in-process. Set to 0 to disable caching.")
+	flag.DurationVar(&c.CheckoutTimeout, "checkoutTimeout", LookupEnvDuration("CHECKOKUT_TIMEOUT", model.DefaultCheckoutTimeout), "How long item can be reserved by user in format that can be parsed by go's time.ParseDuration. Used for new sales which don't set their own timeout.")
+
+	flag.DurationVar(&c.CheckoutExtension, "checkoutExtension", LookupEnvDuration("CHECKOUT_EXTENSION", model.DefaultCheckoutTimeout), "How far reservation is pushed forward when user extends the checkout.")
+	flag.IntVar(&c.MaxCheckoutExtensions, "maxCheckoutExtensions", LookupEnvInt("MAX_CHECKOUT_EXTENSIONS", model.DefaultMaxCheckoutExtensions), "How many times single checkout can be extended.")
+
+	flag.StringVar(&c.CodeKeys, "codeKeys", LookupEnvString("CODE_KEYS", ""), `Keys used to sign checkout codes in "id1:secret1,id2:secret2" format. The first key is used for signing, the rest are only accepted. Required.`)
+	flag.BoolVar(&c.AcceptLegacyCodes, "acceptLegacyCodes", LookupEnvBool("ACCEPT_LEGACY_CODES", false), "Set to accept unsigned checkout codes issued before signing keys were configured. Must be unset once they have expired, since such codes can be forged.")
+	flag.StringVar(&c.CodeGenerator, "codeGenerator", LookupEnvString("CODE_GENERATOR", "random"), `Generator of checkout codes: "random" or "unique" (prefixed with time and counter, so codes never collide within an instance).`)
+	flag.IntVar(&c.CodeLen, "codeLen", LookupEnvInt("CODE_LEN", model.DefaultCodeLen), "Length of random part of checkout codes.")
+	flag.StringVar(&c.CodeAlphabet, "codeAlphabet", LookupEnvString("CODE_ALPHABET", model.DefaultCodeAlphabet), "Symbols which random part of checkout codes consists of.")
 
 	flag.IntVar(&c.CheckoutsBatchSize, "checkoutsBatchSize", LookupEnvInt("CHECKOUTS_BATCH_SIZE", 500), "Number of checkout attempts to be stored in buffer before being flushed.")
 	flag.DurationVar(&c.CheckoutsFlushInterval, "checkoutsFlushInterval", LookupEnvDuration("CHECKOUTS_FLUSH_INTERVAL", 10*time.Second), "How ofter checkouts buffer should be flushed.")
 
+	flag.DurationVar(&c.ReaperInterval, "reaperInterval", LookupEnvDuration("REAPER_INTERVAL", 5*time.Second), "How often expired reservations should be released and their units returned to stock. Set to 0 to disable.")
+	flag.IntVar(&c.ReaperBatchSize, "reaperBatchSize", LookupEnvInt("REAPER_BATCH_SIZE", 1000), "Max number of expired reservations released by single query.")
+
+	flag.StringVar(&c.PaymentProvider, "paymentProvider", LookupEnvString("PAYMENT_PROVIDER", ""), `Provider charging users on purchase: "fake" or none. If not set, purchases are made without payment step.`)
+	flag.StringVar(&c.FakePaymentOutcome, "fakePaymentOutcome", LookupEnvString("FAKE_PAYMENT_OUTCOME", "succeed"), `How fake payment provider responds: "succeed", "decline" or "timeout".`)
+	flag.DurationVar(&c.PaymentTimeout, "paymentTimeout", LookupEnvDuration("PAYMENT_TIMEOUT", 3*time.Second), "How long payment provider is waited for on purchase. Payment is never waited for longer than the reservation lasts.")
+
+	flag.BoolVar(&c.StreamEvents, "streamEvents", LookupEnvBool("STREAM_EVENTS", false), "Set to serve stream of changes of items' stock of the sales at /sales/{id}/events.")
+	flag.IntVar(&c.EventsHistory, "eventsHistory", LookupEnvInt("EVENTS_HISTORY", 1000), "Number of the latest events kept in-process per sale, so clients can resume the stream after reconnecting.")
+	flag.IntVar(&c.EventsBuffer, "eventsBuffer", LookupEnvInt("EVENTS_BUFFER", 256), "Number of events queued for a stream client before it's disconnected for being too slow.")
+
+	flag.DurationVar(&c.IdempotencyTTL, "idempotencyTTL", LookupEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour), "How long responses to checkouts and purchases made with Idempotency-Key header are kept to be replayed for retries. Set to 0 to ignore the header.")
+	flag.DurationVar(&c.IdempotencyWait, "idempotencyWait", LookupEnvDuration("IDEMPOTENCY_WAIT", 5*time.Second), "How long request waits for another one made with the same Idempotency-Key to complete before it's rejected.")
+
+	flag.StringVar(&c.WSOrigins, "wsOrigins", LookupEnvString("WS_ORIGINS", ""), `Comma-separated host patterns of origins allowed to open WebSocket connections besides the same origin, e.g. "shop.example.com,*.example.com".`)
+	flag.DurationVar(&c.ExpiryWarning, "expiryWarning", LookupEnvDuration("EXPIRY_WARNING", 10*time.Second), "How long before reservation expires WebSocket clients are warned about it.")
+
 	flag.IntVar(&c.SalesCount, "salesCount", LookupEnvInt("SALES_COUNT", 1), "Number of sales to generate (only for items-generator).")
 	flag.IntVar(&c.ItemsPerSale, "itemsPerSale", LookupEnvInt("ITEMS_PER_SALE", model.ItemsPerSale), "Number of items per sale.")
+	flag.IntVar(&c.ItemQuantity, "itemQuantity", LookupEnvInt("ITEM_QUANTITY", 1), "Number of units in stock of each item (only for items-generator).")
+	flag.StringVar(&c.SaleStart, "saleStart", LookupEnvString("SALE_START", ""), "Start of the first sale in RFC 3339 format (only for items-generator). If not set, current time truncated to sale duration is used.")
+	flag.DurationVar(&c.SaleDuration, "saleDuration", LookupEnvDuration("SALE_DURATION", model.DefaultSaleDuration), "Duration of each sale (only for items-generator).")
+	flag.DurationVar(&c.SalesInterval, "salesInterval", LookupEnvDuration("SALES_INTERVAL", 0), "Time between starts of consecutive sales (only for items-generator). Sales overlap if it's less than sale duration. Equals to sale duration if not set.")
 
 	flag.Parse()
 
@@ -27,12 +27,24 @@ func (cd *CheckoutDatabase) Add(ctx context.Context, cos ...model.Checkout) erro
 
 	q := buildBatchQuery(len(cos))
 
-	args := make([]any, 0, len(cos)*5)
+	args := make([]any, 0, len(cos)*8)
 	for _, co := range cos {
+		itemID := sql.NullInt64{Int64: int64(co.ItemID), Valid: co.ItemID != 0}
+		saleID := sql.NullInt64{Int64: int64(co.SaleID), Valid: co.SaleID != 0}
 		code := sql.NullString{String: co.Code, Valid: co.Code != ""}
 		errMsg := sql.NullString{String: co.Error, Valid: co.Error != ""}
 
-		args = append(args, co.UserID, co.ItemID, co.CreatedAt, code, errMsg)
+		kind := co.Kind
+		if kind == "" {
+			kind = model.CheckoutKindCheckout
+		}
+
+		quantity := co.Quantity
+		if quantity == 0 {
+			quantity = 1
+		}
+
+		args = append(args, co.UserID, itemID, saleID, co.CreatedAt, code, errMsg, kind, quantity)
 	}
 
 	res, err := cd.DB.ExecContext(ctx, q, args...)
@@ -51,12 +63,13 @@ func (cd *CheckoutDatabase) Add(ctx context.Context, cos ...model.Checkout) erro
 
 func buildBatchQuery(rows int) string {
 	sb := strings.Builder{}
-	sb.WriteString("insert into checkouts (user_id, item_id, created_at, code, error) values ")
+	sb.WriteString("insert into checkouts (user_id, item_id, sale_id, created_at, code, error, kind, quantity) values ")
 
 	phs := make([]string, 0, rows)
 
 	for i := range rows {
-		phs = append(phs, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", i*5+1, i*5+2, i*5+3, i*5+4, i*5+5))
+		n := i * 8
+		phs = append(phs, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8))
 	}
 
 	sb.WriteString(strings.Join(phs, ","))
@@ -1,18 +1,32 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
 var (
-	ErrNotFound = errors.New("record not found")
+	ErrNotFound   = errors.New("record not found")
+	ErrReferenced = errors.New("record is referenced by other records")
+	// ErrPaymentUnknown is returned by settle funcs when money may have been moved, but the purchase can't be completed.
+	// Such records are left for reconciliation instead of being rolled back.
+	ErrPaymentUnknown = errors.New("outcome of payment is unknown, reconciliation required")
 )
 
+// foreignKeyViolation is SQLSTATE of an attempt to delete the record which is still referenced.
+const foreignKeyViolation = "23503"
+
 func New(addr, database, user, password string) (db *sql.DB, close func() error, err error) {
 	url := fmt.Sprintf("postgres://%s:%s@%s/%s", user, password, addr, database)
 
@@ -37,5 +51,68 @@ func mapError(err error) error {
 	if errors.Is(err, sql.ErrNoRows) {
 		return ErrNotFound
 	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+		return ErrReferenced
+	}
+
 	return err
 }
+
+// queryArgs collects args of a query built on the fly.
+type queryArgs []any
+
+// add appends the arg and returns its placeholder.
+func (a *queryArgs) add(v any) string {
+	*a = append(*a, v)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+
+	return "where " + strings.Join(conds, " and ") + "\n"
+}
+
+// keysetCond builds condition selecting the records which follow the cursor in the order of field and id.
+// typ is SQL type of the field which cursor value is cast to.
+func keysetCond(field, typ string, desc bool, after model.Cursor, args *queryArgs) string {
+	op := " > "
+	if desc {
+		op = " < "
+	}
+
+	if field == "id" {
+		return "id" + op + args.add(after.ID)
+	}
+
+	return "(" + field + ", id)" + op + "(" + args.add(after.Value) + "::" + typ + ", " + args.add(after.ID) + "::int)"
+}
+
+// estimateCount returns the number of rows which planner expects the query to return.
+// It's based on table statistics, so it's cheap, but may be far from the exact number.
+func estimateCount(ctx context.Context, db *sql.DB, query string, args ...any) (int, error) {
+	var plan []byte
+	if err := db.QueryRowContext(ctx, "explain (format json) "+query, args...).Scan(&plan); err != nil {
+		return 0, fmt.Errorf("can't explain query: %w", err)
+	}
+
+	var parsed []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+
+	if err := json.Unmarshal(plan, &parsed); err != nil {
+		return 0, fmt.Errorf("can't parse query plan: %w", err)
+	}
+
+	if len(parsed) == 0 {
+		return 0, errors.New("query plan is empty")
+	}
+
+	return int(parsed[0].Plan.Rows), nil
+}
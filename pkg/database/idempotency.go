@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/idempotency"
+)
+
+// IdempotencyDatabase keeps idempotency keys while Redis is unavailable, see idempotency.Store.
+type IdempotencyDatabase struct {
+	DB *sql.DB
+}
+
+func (id *IdempotencyDatabase) Begin(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*idempotency.Response, error) {
+	// the expired key is taken over as if it didn't exist
+	const lock = `
+		insert into idempotency_keys (key, fingerprint, expires_at)
+		values ($1, $2, now() + make_interval(secs => $3))
+		on conflict (key) do update
+		set fingerprint = excluded.fingerprint, status = null, header = null, body = null, expires_at = excluded.expires_at
+		where idempotency_keys.expires_at <= now()
+	`
+
+	res, err := id.DB.ExecContext(ctx, lock, key, fingerprint, lockTTL.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("can't lock key: %w", err)
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("can't get affected rows: %w", err)
+	} else if affected == 1 {
+		return nil, nil
+	}
+
+	const get = `
+		select fingerprint, status, header, body
+		from idempotency_keys
+		where key = $1
+	`
+
+	var (
+		fp     string
+		status sql.NullInt64
+		header []byte
+		resp   idempotency.Response
+	)
+
+	err = id.DB.QueryRowContext(ctx, get, key).Scan(&fp, &status, &header, &resp.Body)
+	if err != nil {
+		// the key has been aborted in the meantime, so it's about to be locked by another request
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, idempotency.ErrInProgress
+		}
+
+		return nil, fmt.Errorf("can't get key: %w", err)
+	}
+
+	switch {
+	case fp != fingerprint:
+		return nil, idempotency.ErrMismatch
+	case !status.Valid:
+		return nil, idempotency.ErrInProgress
+	}
+
+	resp.Status = int(status.Int64)
+	if err := json.Unmarshal(header, &resp.Header); err != nil {
+		return nil, fmt.Errorf("can't decode saved header: %w", err)
+	}
+
+	return &resp, nil
+}
+
+func (id *IdempotencyDatabase) Complete(ctx context.Context, key, fingerprint string, resp idempotency.Response, ttl time.Duration) error {
+	header, err := json.Marshal(resp.Header)
+	if err != nil {
+		return fmt.Errorf("can't encode header: %w", err)
+	}
+
+	const q = `
+		update idempotency_keys
+		set status = $3, header = $4, body = $5, expires_at = now() + make_interval(secs => $6)
+		where key = $1 and fingerprint = $2
+	`
+
+	if _, err := id.DB.ExecContext(ctx, q, key, fingerprint, resp.Status, header, resp.Body, ttl.Seconds()); err != nil {
+		return fmt.Errorf("can't save response: %w", err)
+	}
+
+	return nil
+}
+
+func (id *IdempotencyDatabase) Abort(ctx context.Context, key, fingerprint string) error {
+	const q = `
+		delete from idempotency_keys
+		where key = $1 and fingerprint = $2 and status is null
+	`
+
+	if _, err := id.DB.ExecContext(ctx, q, key, fingerprint); err != nil {
+		return fmt.Errorf("can't unlock key: %w", err)
+	}
+
+	return nil
+}
+
+func (id *IdempotencyDatabase) DeleteExpired(ctx context.Context) (int, error) {
+	res, err := id.DB.ExecContext(ctx, "delete from idempotency_keys where expires_at <= now()")
+	if err != nil {
+		return 0, fmt.Errorf("can't delete expired keys: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("can't get affected rows: %w", err)
+	}
+
+	return int(affected), nil
+}
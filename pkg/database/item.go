@@ -3,17 +3,62 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/IlyushaZ/not-back-contest/pkg/model"
 )
 
 type ItemRepository interface {
-	// Checkout tries to reserve the item for given user for timeout seconds/minutes/hours.
-	Checkout(ctx context.Context, userID, itemID int, code model.CheckoutCode, timeout time.Duration) error
-	Purchase(ctx context.Context, code model.CheckoutCode) error
-	GetPage(ctx context.Context, num, size int) ([]model.Item, int, error)
+	// Checkout tries to reserve quantity units of the item for given user for timeout seconds/minutes/hours.
+	Checkout(ctx context.Context, userID, itemID, quantity int, code model.CheckoutCode, timeout time.Duration) error
+	// CheckoutMany reserves either all of the items with a single code or none of them.
+	CheckoutMany(ctx context.Context, userID int, items []model.CartItem, code model.CheckoutCode, timeout time.Duration) error
+	// CheckoutAny reserves a unit of any item of the sale which is available at the moment and returns item's ID.
+	CheckoutAny(ctx context.Context, userID, saleID int, code model.CheckoutCode, timeout time.Duration) (int, error)
+	// Purchase buys all the units reserved with given code and creates an order for each of the items
+	// in the same transaction. Orders are returned.
+	// If settle is not nil, it's called with the orders to be created before they are, while the reservations
+	// are put on hold, but not locked. If it fails, nothing is purchased and the reservations are active again.
+	// PaymentIDs set by settle are saved to orders.
+	Purchase(ctx context.Context, code model.CheckoutCode, settle func([]model.Order) error) ([]model.Order, error)
+	// Cancel releases the units reserved with given code, so they become available for checkout right away.
+	// Released units are returned.
+	Cancel(ctx context.Context, code model.CheckoutCode) ([]model.CartItem, error)
+	// Refund returns req.Quantity units of the order and stores the refund record.
+	// Units are put back to stock if it's requested and the sale has not ended yet, otherwise they are written off.
+	// If settle is not nil, it's called with the refund while it's pending, but the order is not locked.
+	// If it fails, nothing is refunded, unless it reports ErrPaymentUnknown, in which case the refund is left pending.
+	Refund(ctx context.Context, orderID int, req model.RefundRequest, settle func(model.Order, model.Refund) error) (model.Refund, error)
+	// Extend pushes reservation made with given code forward by ext, but not further than the end of the sale.
+	// Reservation can be extended no more than maxExtensions times.
+	Extend(ctx context.Context, code model.CheckoutCode, ext time.Duration, maxExtensions int) (time.Time, error)
+	// FlagStalePayments moves the reservations which have been on hold for payment for longer than they are reserved
+	// by staleAfter to 'payment_unknown' status and returns them. Their units are not released, since money may have
+	// been charged for them, so they must be reconciled with payment provider.
+	FlagStalePayments(ctx context.Context, staleAfter time.Duration) ([]model.Reservation, error)
+	// ReleaseExpired releases up to limit reservations which have expired without purchase,
+	// returns their units to stock and stores "expired" records to checkouts. Released reservations are returned,
+	// their Code is the nonce (CheckoutCode.Rand) of the code they were made with.
+	// It's safe to call it concurrently from multiple instances: only one of them does the job at a time,
+	// while the others get nothing.
+	ReleaseExpired(ctx context.Context, limit int) ([]model.Checkout, error)
+	GetSaleID(ctx context.Context, itemID int) (int, error)
+	// GetPage returns a page of items matching the filter along with the total number of them.
+	GetPage(ctx context.Context, filter model.ItemFilter, num, size int) ([]model.Item, int, error)
+	// GetPageAfter returns up to size items matching the filter which follow the cursor.
+	// Cursor pointing to the last of them is returned, nil if there are no more items.
+	GetPageAfter(ctx context.Context, filter model.ItemFilter, after model.Cursor, size int) ([]model.Item, *model.Cursor, error)
+	// EstimateCount returns the number of items matching the filter as planner estimates it.
+	EstimateCount(ctx context.Context, filter model.ItemFilter) (int, error)
+	// GetUserOrders returns a page of user's orders, the latest first.
+	GetUserOrders(ctx context.Context, userID, num, size int) ([]model.Order, int, error)
+	// GetUserReservations returns a page of user's reservations which are active at the moment, the latest first.
+	// Codes of the reservations are restored as they are issued on checkout (or on the latest extension).
+	GetUserReservations(ctx context.Context, userID, num, size int) ([]model.Reservation, int, error)
 }
 
 type ItemDatabase struct {
@@ -44,42 +89,362 @@ type preparedStmt struct {
 	query string
 }
 
+// Units are taken from stock on checkout, so available_quantity never counts the reserved ones.
+// Reservation is created in the same statement, which makes both changes atomic.
 var (
 	stmts = []preparedStmt{
 		{
 			name: "checkout_item",
 			query: `
+				with item as (
+					update items
+					set available_quantity = available_quantity - $3
+					where id = $2
+					  and available_quantity >= $3
+					  and sale_start < $6 and sale_end > $6
+					  and not sale_paused
+					returning id
+				)
+				insert into reservations (created_at, item_id, user_id, quantity, code, reserved_until)
+				select $6, id, $1, $3, $4, $5
+				from item
+			`,
+		},
+		// items of the cart are locked in the order of their IDs before they are updated, so concurrent checkouts
+		// of overlapping carts wait for each other instead of deadlocking
+		{
+			name: "lock_items",
+			query: `
+				select id
+				from items
+				where id = any($1)
+				order by id
+				for update
+			`,
+		},
+		{
+			name: "checkout_items",
+			query: `
+				with cart as (
+					select item_id, quantity
+					from unnest($2::int[], $3::int[]) as c(item_id, quantity)
+				), item as (
+					update items
+					set available_quantity = items.available_quantity - cart.quantity
+					from cart
+					where items.id = cart.item_id
+					  and items.available_quantity >= cart.quantity
+					  and items.sale_start < $6 and items.sale_end > $6
+					  and not items.sale_paused
+					returning items.id, cart.quantity
+				)
+				insert into reservations (created_at, item_id, user_id, quantity, code, reserved_until)
+				select $6, id, $1, quantity, $4, $5
+				from item
+			`,
+		},
+		{
+			name: "release_expired_reservations",
+			query: `
+				with expired as (
+					select id
+					from reservations
+					where status = 'active'
+					  and reserved_until < $1
+					order by reserved_until
+					limit $2
+					for update skip locked
+				), released as (
+					update reservations r
+					set status = 'expired'
+					from expired
+					where r.id = expired.id
+					returning r.item_id, r.user_id, r.quantity, r.code
+				), restocked as (
+					update items
+					set available_quantity = items.available_quantity + r.quantity
+					from (
+						-- single row of items can't be updated twice by one statement
+						select item_id, sum(quantity) as quantity
+						from released
+						group by item_id
+					) r
+					where items.id = r.item_id
+				), logged as (
+					insert into checkouts (user_id, item_id, created_at, kind, quantity)
+					select user_id, item_id, $1, 'expired', quantity
+					from released
+				)
+				select item_id, user_id, quantity, code
+				from released
+			`,
+		},
+		// skip locked makes concurrent requests pick different items instead of waiting for each other
+		{
+			name: "checkout_any_item",
+			query: `
+				with item as (
+					update items
+					set available_quantity = available_quantity - 1
+					where id = (
+						select id
+						from items
+						where sale_id = $2
+						  and available_quantity > 0
+						  and sale_start < $5 and sale_end > $5
+						  and not sale_paused
+						limit 1
+						for update skip locked
+					)
+					returning id
+				)
+				insert into reservations (created_at, item_id, user_id, quantity, code, reserved_until)
+				select $5, id, $1, 1, $3, $4
+				from item
+				returning item_id
+			`,
+		},
+		// reservations made with the same code (e.g. cart) are purchased, cancelled and extended all together
+		{
+			name: "purchase_reservations",
+			query: `
+				with purchased as (
+					update reservations r
+					set status = 'purchased'
+					from items i
+					where r.item_id = i.id
+					  and r.user_id = $1
+					  and r.code = $2
+					  and r.status = 'active'
+					  and r.reserved_until > $3
+					  and i.sale_start < $3
+					  and i.sale_end > $3
+					  and not i.sale_paused
+					returning r.id, r.item_id, r.quantity
+				), sold as (
+					update items
+					set sold_quantity = items.sold_quantity + purchased.quantity,
+					    sold = items.sold_quantity + purchased.quantity = items.quantity
+					from purchased
+					where items.id = purchased.item_id
+					returning items.id, items.sale_id, items.price, items.original_price, items.currency,
+					          purchased.id as reservation_id, purchased.quantity
+				)
+				insert into orders (created_at, user_id, item_id, sale_id, reservation_id, quantity, price, original_price, currency, code)
+				select $3, $1, id, sale_id, reservation_id, quantity, price, original_price, currency, $2
+				from sold
+				returning id, created_at, user_id, item_id, sale_id, reservation_id, quantity, price, original_price, currency, refunded_quantity
+			`,
+		},
+		{
+			name: "count_unpurchased",
+			query: `
+				select count(*)
+				from reservations
+				where user_id = $1
+				  and code = $2
+				  and status = 'active'
+			`,
+		},
+		// reservations being paid for are put on hold, so neither cancel nor reaper can release them meanwhile,
+		// while no rows stay locked until the payment is done
+		{
+			name: "hold_reservations",
+			query: `
+				update reservations r
+				set status = 'paying'
+				from items i
+				where r.item_id = i.id
+				  and r.user_id = $1
+				  and r.code = $2
+				  and r.status = 'active'
+				  and r.reserved_until > $3
+				  and i.sale_start < $3
+				  and i.sale_end > $3
+				  and not i.sale_paused
+				returning r.id, r.item_id, i.sale_id, r.quantity, i.price, i.original_price, i.currency
+			`,
+		},
+		// reservations left on hold by the instance which has failed to finish the purchase may have been paid for,
+		// so they are not released, but left for reconciliation
+		{
+			name: "flag_stale_payments",
+			query: `
+				update reservations
+				set status = 'payment_unknown'
+				where status = 'paying'
+				  and reserved_until < $1
+				returning id, created_at, item_id, user_id, quantity, code, reserved_until, extensions
+			`,
+		},
+		// reservations are made active again if payment has failed, or left for reconciliation
+		// with 'payment_unknown' status if money may have been moved
+		{
+			name: "unhold_reservations",
+			query: `
+				update reservations
+				set status = $3
+				where user_id = $1
+				  and code = $2
+				  and status = 'paying'
+			`,
+		},
+		// orders are created with the prices which have been paid, even if the items have been changed meanwhile
+		{
+			name: "purchase_held_reservations",
+			query: `
+				with paid as (
+					select *
+					from unnest($3::int[], $4::bigint[], $5::bigint[], $6::text[], $7::text[])
+					     as p(reservation_id, price, original_price, currency, payment_id)
+				), purchased as (
+					update reservations r
+					set status = 'purchased'
+					from paid
+					where r.id = paid.reservation_id
+					  and r.user_id = $1
+					  and r.code = $2
+					  and r.status = 'paying'
+					returning r.id, r.item_id, r.quantity, paid.price, paid.original_price, paid.currency, paid.payment_id
+				), sold as (
+					update items
+					set sold_quantity = items.sold_quantity + purchased.quantity,
+					    sold = items.sold_quantity + purchased.quantity = items.quantity
+					from purchased
+					where items.id = purchased.item_id
+					returning items.id, items.sale_id, purchased.id as reservation_id, purchased.quantity,
+					          purchased.price, purchased.original_price, purchased.currency, purchased.payment_id
+				)
+				insert into orders (created_at, user_id, item_id, sale_id, reservation_id, quantity, price, original_price, currency, code, payment_id)
+				select $8, $1, id, sale_id, reservation_id, quantity, price, original_price, currency, $2, nullif(payment_id, '')
+				from sold
+				returning id, created_at, user_id, item_id, sale_id, reservation_id, quantity, price, original_price, currency, refunded_quantity
+			`,
+		},
+		{
+			name: "lock_order",
+			query: `
+				select o.id, o.created_at, o.user_id, o.item_id, o.sale_id, o.reservation_id, o.quantity,
+				       o.price, o.original_price, o.currency, coalesce(o.payment_id, ''), o.refunded_quantity,
+				       i.sale_end
+				from orders o
+				join items i on i.id = o.item_id
+				where o.id = $1
+				for update of o
+			`,
+		},
+		// refund is held before money is returned, so its units can't be refunded twice meanwhile
+		{
+			name: "hold_refund",
+			query: `
+				with refunded as (
+					update orders
+					set refunded_quantity = refunded_quantity + $2
+					where id = $1
+				)
+				insert into refunds (created_at, order_id, quantity, amount, restocked, reason, status)
+				values ($4, $1, $2, $5, $3, $6, 'pending')
+				returning id
+			`,
+		},
+		// units which are not restocked are written off, so the stock is consistent with what's left of it
+		{
+			name: "complete_refund",
+			query: `
+				with completed as (
+					update refunds
+					set status = 'completed'
+					where id = $1
+					  and status = 'pending'
+					returning quantity, restocked
+				)
 				update items
-				set reserved_by = $1, reserved_until = $2, code = $3
-				where id = $4
-				  and not sold
-				  and sale_start < $5 and sale_end > $5
-				  and (reserved_until is null or reserved_until < $5)
+				set sold_quantity = sold_quantity - c.quantity,
+				    available_quantity = available_quantity + case when c.restocked then c.quantity else 0 end,
+				    quantity = quantity - case when c.restocked then 0 else c.quantity end,
+				    sold = sold and not c.restocked
+				from completed c
+				where items.id = $2
 			`,
 		},
 		{
-			name: "purchase_item",
+			name: "fail_refund",
 			query: `
+				with failed as (
+					update refunds
+					set status = 'failed'
+					where id = $1
+					  and status = 'pending'
+					returning order_id, quantity
+				)
+				update orders
+				set refunded_quantity = refunded_quantity - f.quantity
+				from failed f
+				where orders.id = f.order_id
+			`,
+		},
+		{
+			name: "cancel_reservations",
+			query: `
+				with cancelled as (
+					update reservations
+					set status = 'cancelled'
+					where user_id = $1
+					  and code = $2
+					  and status = 'active'
+					  and reserved_until > $3
+					returning item_id, quantity
+				)
 				update items
-				set sold = true
-				where id = $1
-				  and not sold
-				  and reserved_by = $2
-				  and code = $3
-				  and reserved_until > $4
-				  and sale_start < $4
-				  and sale_end > $4
+				set available_quantity = items.available_quantity + cancelled.quantity
+				from cancelled
+				where items.id = cancelled.item_id
+				returning items.id, cancelled.quantity
+			`,
+		},
+		// items of the cart may belong to sales ending at different time, so the earliest expiration is returned
+		{
+			name: "extend_reservations",
+			query: `
+				with extended as (
+					update reservations r
+					set reserved_until = least(r.reserved_until + make_interval(secs => $1), i.sale_end),
+					    extensions = r.extensions + 1
+					from items i
+					where r.item_id = i.id
+					  and r.user_id = $2
+					  and r.code = $3
+					  and r.status = 'active'
+					  and r.reserved_until > $4
+					  and r.extensions < $5
+					returning r.reserved_until
+				)
+				select min(reserved_until)
+				from extended
+				having count(*) > 0
+			`,
+		},
+		{
+			name: "checkout_extensions",
+			query: `
+				select extensions
+				from reservations
+				where user_id = $1
+				  and code = $2
+				  and status = 'active'
+				  and reserved_until > $3
+				limit 1
 			`,
 		},
 	}
 )
 
-func (i *ItemDatabase) Checkout(ctx context.Context, userID, itemID int, code model.CheckoutCode, checkoutTimeout time.Duration) error {
+func (i *ItemDatabase) Checkout(ctx context.Context, userID, itemID, quantity int, code model.CheckoutCode, checkoutTimeout time.Duration) error {
 	now := time.Now()
 
-	res, err := i.stmts["checkout_item"].ExecContext(ctx, userID, now.Add(checkoutTimeout), code.Rand, itemID, now)
+	res, err := i.stmts["checkout_item"].ExecContext(ctx, userID, itemID, quantity, code.Rand, now.Add(checkoutTimeout), now)
 	if err != nil {
-		return fmt.Errorf("can't update item: %w", err)
+		return fmt.Errorf("can't reserve item: %w", err)
 	}
 
 	if affected, err := res.RowsAffected(); err != nil {
@@ -91,56 +456,801 @@ func (i *ItemDatabase) Checkout(ctx context.Context, userID, itemID int, code mo
 	return nil
 }
 
-func (i *ItemDatabase) Purchase(ctx context.Context, code model.CheckoutCode) error {
-	res, err := i.stmts["purchase_item"].ExecContext(ctx, code.ItemID, code.UserID, code.Rand, time.Now())
+func (i *ItemDatabase) CheckoutMany(ctx context.Context, userID int, items []model.CartItem, code model.CheckoutCode, checkoutTimeout time.Duration) error {
+	now := time.Now()
+
+	itemIDs := make([]int, 0, len(items))
+	quantities := make([]int, 0, len(items))
+	for _, item := range items {
+		itemIDs = append(itemIDs, item.ItemID)
+		quantities = append(quantities, item.Quantity)
+	}
+
+	return WithTx(i.db, func(tx *sql.Tx) error {
+		if _, err := tx.StmtContext(ctx, i.stmts["lock_items"]).ExecContext(ctx, itemIDs); err != nil {
+			return fmt.Errorf("can't lock items: %w", err)
+		}
+
+		res, err := tx.StmtContext(ctx, i.stmts["checkout_items"]).ExecContext(ctx, userID, itemIDs, quantities, code.Rand, now.Add(checkoutTimeout), now)
+		if err != nil {
+			return fmt.Errorf("can't reserve items: %w", err)
+		}
+
+		if affected, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("can't get affected rows: %w", err)
+		} else if int(affected) != len(items) {
+			// returning an error rolls back reservations of the items which were available
+			return model.ErrItemUnavailable
+		}
+
+		return nil
+	})
+}
+
+func (i *ItemDatabase) CheckoutAny(ctx context.Context, userID, saleID int, code model.CheckoutCode, checkoutTimeout time.Duration) (int, error) {
+	now := time.Now()
+
+	var itemID int
+
+	err := i.stmts["checkout_any_item"].QueryRowContext(ctx, userID, saleID, code.Rand, now.Add(checkoutTimeout), now).Scan(&itemID)
+	switch err = mapError(err); {
+	case err == ErrNotFound:
+		return 0, model.ErrItemUnavailable
+	case err != nil:
+		return 0, fmt.Errorf("can't reserve item: %w", err)
+	}
+
+	return itemID, nil
+}
+
+func (i *ItemDatabase) Purchase(ctx context.Context, code model.CheckoutCode, settle func([]model.Order) error) ([]model.Order, error) {
+	if settle != nil {
+		return i.purchaseSettled(ctx, code, settle)
+	}
+
+	var orders []model.Order
+
+	err := WithTx(i.db, func(tx *sql.Tx) error {
+		rows, err := tx.StmtContext(ctx, i.stmts["purchase_reservations"]).QueryContext(ctx, code.UserID, code.Rand, time.Now())
+		if err != nil {
+			return fmt.Errorf("can't purchase reservations: %w", err)
+		}
+
+		orders, err = scanOrders(rows)
+		if err != nil {
+			return err
+		}
+
+		return i.checkAllTaken(ctx, tx, code, len(orders))
+	})
 	if err != nil {
-		return fmt.Errorf("can't update item's status: %w", err)
+		return nil, err
 	}
 
-	if affected, err := res.RowsAffected(); err != nil {
-		return fmt.Errorf("can't get affected rows: %w", err)
-	} else if affected == 0 {
+	return orders, nil
+}
+
+// purchaseSettled puts the reservations on hold, settles the purchase outside of transaction and then buys them,
+// so the rows are not locked while settle waits for payment provider.
+// If settle fails, the reservations are made active again, unless it reports ErrPaymentUnknown.
+// Once settle has succeeded, the reservations are never made active again, as money has been moved.
+func (i *ItemDatabase) purchaseSettled(ctx context.Context, code model.CheckoutCode, settle func([]model.Order) error) ([]model.Order, error) {
+	var held []model.Order
+
+	err := WithTx(i.db, func(tx *sql.Tx) error {
+		rows, err := tx.StmtContext(ctx, i.stmts["hold_reservations"]).QueryContext(ctx, code.UserID, code.Rand, time.Now())
+		if err != nil {
+			return fmt.Errorf("can't hold reservations: %w", err)
+		}
+
+		held, err = scanHeldOrders(rows)
+		if err != nil {
+			return err
+		}
+
+		return i.checkAllTaken(ctx, tx, code, len(held))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the reservations must not stay on hold once settle is called, even if client has gone
+	ctx = context.WithoutCancel(ctx)
+
+	if err := settle(held); err != nil {
+		status := model.ReservationStatusActive
+		if errors.Is(err, ErrPaymentUnknown) {
+			status = model.ReservationStatusPaymentUnknown
+		}
+
+		if uerr := i.unhold(ctx, code, status); uerr != nil {
+			return nil, fmt.Errorf("%w. original error: %w", uerr, err)
+		}
+
+		return nil, err
+	}
+
+	var (
+		ids            = make([]int, 0, len(held))
+		prices         = make([]int64, 0, len(held))
+		originalPrices = make([]int64, 0, len(held))
+		currencies     = make([]string, 0, len(held))
+		paymentIDs     = make([]string, 0, len(held))
+	)
+
+	for _, o := range held {
+		ids = append(ids, o.ReservationID)
+		prices = append(prices, o.Price)
+		originalPrices = append(originalPrices, o.OriginalPrice)
+		currencies = append(currencies, o.Currency)
+		paymentIDs = append(paymentIDs, o.PaymentID)
+	}
+
+	var orders []model.Order
+
+	err = WithTx(i.db, func(tx *sql.Tx) error {
+		rows, err := tx.StmtContext(ctx, i.stmts["purchase_held_reservations"]).QueryContext(ctx,
+			code.UserID, code.Rand, ids, prices, originalPrices, currencies, paymentIDs, time.Now(),
+		)
+		if err != nil {
+			return fmt.Errorf("can't purchase reservations: %w", err)
+		}
+
+		orders, err = scanOrders(rows)
+		if err != nil {
+			return err
+		}
+
+		if len(orders) != len(held) {
+			return fmt.Errorf("%d of the reservations are not held anymore", len(held)-len(orders))
+		}
+
+		return nil
+	})
+	if err != nil {
+		if uerr := i.unhold(ctx, code, model.ReservationStatusPaymentUnknown); uerr != nil {
+			err = fmt.Errorf("%w. original error: %w", uerr, err)
+		}
+
+		return nil, fmt.Errorf("%w: %v", ErrPaymentUnknown, err)
+	}
+
+	paymentByReservation := make(map[int]string, len(held))
+	for _, o := range held {
+		paymentByReservation[o.ReservationID] = o.PaymentID
+	}
+
+	for j := range orders {
+		orders[j].PaymentID = paymentByReservation[orders[j].ReservationID]
+	}
+
+	return orders, nil
+}
+
+// unhold moves the reservations put on hold to the status.
+func (i *ItemDatabase) unhold(ctx context.Context, code model.CheckoutCode, status model.ReservationStatus) error {
+	if _, err := i.stmts["unhold_reservations"].ExecContext(ctx, code.UserID, code.Rand, status); err != nil {
+		return fmt.Errorf("can't move held reservations to %s: %w", status, err)
+	}
+
+	return nil
+}
+
+// checkAllTaken makes sure that taken reservations are all the ones made with the code,
+// otherwise (e.g. when some of the sales has already ended) nothing must be purchased.
+func (i *ItemDatabase) checkAllTaken(ctx context.Context, tx *sql.Tx, code model.CheckoutCode, taken int) error {
+	if taken == 0 {
 		return fmt.Errorf("either item or checkout does not exist: %w", ErrNotFound)
 	}
 
+	var left int
+	if err := tx.StmtContext(ctx, i.stmts["count_unpurchased"]).QueryRowContext(ctx, code.UserID, code.Rand).Scan(&left); err != nil {
+		return fmt.Errorf("can't count unpurchased reservations: %w", err)
+	}
+
+	if left != 0 {
+		return fmt.Errorf("%d of the reservations can't be purchased: %w", left, ErrNotFound)
+	}
+
 	return nil
 }
 
-func (i *ItemDatabase) GetPage(ctx context.Context, num, size int) ([]model.Item, int, error) {
+func (i *ItemDatabase) Cancel(ctx context.Context, code model.CheckoutCode) ([]model.CartItem, error) {
+	rows, err := i.stmts["cancel_reservations"].QueryContext(ctx, code.UserID, code.Rand, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("can't cancel reservations: %w", err)
+	}
+
+	items, err := scanCartItems(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("either item or checkout does not exist: %w", ErrNotFound)
+	}
+
+	return items, nil
+}
+
+// Refund holds the refund in a transaction, settles it outside of transaction and then completes it,
+// so the order is not locked while settle waits for payment provider.
+// If settle fails, the refund is failed and its units can be refunded again, unless it reports ErrPaymentUnknown,
+// in which case the refund is left pending.
+func (i *ItemDatabase) Refund(ctx context.Context, orderID int, req model.RefundRequest, settle func(model.Order, model.Refund) error) (model.Refund, error) {
+	now := time.Now()
+
+	var (
+		o      model.Order
+		refund model.Refund
+	)
+
+	err := WithTx(i.db, func(tx *sql.Tx) error {
+		var saleEnd time.Time
+
+		err := tx.StmtContext(ctx, i.stmts["lock_order"]).QueryRowContext(ctx, orderID).Scan(
+			&o.ID, &o.CreatedAt, &o.UserID, &o.ItemID, &o.SaleID, &o.ReservationID, &o.Quantity,
+			&o.Price, &o.OriginalPrice, &o.Currency, &o.PaymentID, &o.RefundedQuantity,
+			&saleEnd,
+		)
+		if err != nil {
+			return fmt.Errorf("can't get order: %w", mapError(err))
+		}
+
+		quantity := req.Quantity
+		if quantity == 0 {
+			quantity = o.Quantity - o.RefundedQuantity
+		}
+
+		if quantity <= 0 || o.RefundedQuantity+quantity > o.Quantity {
+			return model.ErrInvalidRefund
+		}
+
+		refund = model.Refund{
+			Base:      model.Base{CreatedAt: now},
+			OrderID:   o.ID,
+			UserID:    o.UserID,
+			ItemID:    o.ItemID,
+			SaleID:    o.SaleID,
+			Quantity:  quantity,
+			Amount:    o.Price * int64(quantity),
+			Currency:  o.Currency,
+			Restocked: req.Restock && saleEnd.After(now),
+			Reason:    req.Reason,
+			Status:    model.RefundStatusPending,
+		}
+
+		err = tx.StmtContext(ctx, i.stmts["hold_refund"]).QueryRowContext(
+			ctx, o.ID, refund.Quantity, refund.Restocked, now, refund.Amount, refund.Reason,
+		).Scan(&refund.ID)
+		if err != nil {
+			return fmt.Errorf("can't hold refund: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return model.Refund{}, err
+	}
+
+	// the refund must not stay pending once settle is called, even if client has gone
+	ctx = context.WithoutCancel(ctx)
+
+	if settle != nil {
+		if err := settle(o, refund); err != nil {
+			if errors.Is(err, ErrPaymentUnknown) {
+				return model.Refund{}, err
+			}
+
+			if _, ferr := i.stmts["fail_refund"].ExecContext(ctx, refund.ID); ferr != nil {
+				return model.Refund{}, fmt.Errorf("%w: can't fail refund: %v. original error: %w", ErrPaymentUnknown, ferr, err)
+			}
+
+			return model.Refund{}, err
+		}
+	}
+
+	res, err := i.stmts["complete_refund"].ExecContext(ctx, refund.ID, o.ItemID)
+	if err != nil {
+		return model.Refund{}, fmt.Errorf("%w: can't complete refund: %v", ErrPaymentUnknown, err)
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return model.Refund{}, fmt.Errorf("%w: can't get affected rows: %v", ErrPaymentUnknown, err)
+	} else if affected != 1 {
+		return model.Refund{}, fmt.Errorf("%w: refund is not pending anymore", ErrPaymentUnknown)
+	}
+
+	refund.Status = model.RefundStatusCompleted
+
+	return refund, nil
+}
+
+func (i *ItemDatabase) Extend(ctx context.Context, code model.CheckoutCode, ext time.Duration, maxExtensions int) (time.Time, error) {
+	now := time.Now()
+
+	var until time.Time
+
+	err := i.stmts["extend_reservations"].QueryRowContext(ctx, ext.Seconds(), code.UserID, code.Rand, now, maxExtensions).Scan(&until)
+	if err == nil {
+		return until, nil
+	}
+
+	if mapError(err) != ErrNotFound {
+		return time.Time{}, fmt.Errorf("can't extend reservation: %w", err)
+	}
+
+	// figure out whether there is no such checkout at all or it has just run out of extensions
+	var extensions int
+
+	err = i.stmts["checkout_extensions"].QueryRowContext(ctx, code.UserID, code.Rand, now).Scan(&extensions)
+	switch err = mapError(err); {
+	case err == ErrNotFound:
+		return time.Time{}, fmt.Errorf("either item or checkout does not exist: %w", ErrNotFound)
+	case err != nil:
+		return time.Time{}, fmt.Errorf("can't get checkout extensions: %w", err)
+	case extensions >= maxExtensions:
+		return time.Time{}, model.ErrExtensionsExceeded
+	default:
+		// extended concurrently or expired between two queries
+		return time.Time{}, fmt.Errorf("checkout was modified concurrently: %w", ErrNotFound)
+	}
+}
+
+func (i *ItemDatabase) FlagStalePayments(ctx context.Context, staleAfter time.Duration) ([]model.Reservation, error) {
+	rows, err := i.stmts["flag_stale_payments"].QueryContext(ctx, time.Now().Add(-staleAfter))
+	if err != nil {
+		return nil, fmt.Errorf("can't flag stale payments: %w", err)
+	}
+	defer rows.Close()
+
+	var rs []model.Reservation
+	for rows.Next() {
+		r := model.Reservation{Status: model.ReservationStatusPaymentUnknown}
+
+		err := rows.Scan(&r.ID, &r.CreatedAt, &r.ItemID, &r.UserID, &r.Quantity, &r.Code.Rand, &r.ReservedUntil, &r.Extensions)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan reservation: %w", err)
+		}
+
+		r.Code.UserID = r.UserID
+		rs = append(rs, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over reservations: %w", err)
+	}
+
+	return rs, nil
+}
+
+func (i *ItemDatabase) ReleaseExpired(ctx context.Context, limit int) ([]model.Checkout, error) {
+	now := time.Now()
+
+	var cos []model.Checkout
+
+	err := WithTx(i.db, func(tx *sql.Tx) error {
+		// the lock is released on commit or rollback
+		var locked bool
+		if err := tx.QueryRowContext(ctx, `select pg_try_advisory_xact_lock(hashtext('release_expired_items'))`).Scan(&locked); err != nil {
+			return fmt.Errorf("can't acquire advisory lock: %w", err)
+		}
+
+		if !locked {
+			return nil // someone else is releasing items at the moment
+		}
+
+		rows, err := tx.StmtContext(ctx, i.stmts["release_expired_reservations"]).QueryContext(ctx, now, limit)
+		if err != nil {
+			return fmt.Errorf("can't release expired reservations: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			co := model.Checkout{
+				Base: model.Base{CreatedAt: now},
+				Kind: model.CheckoutKindExpired,
+			}
+
+			if err := rows.Scan(&co.ItemID, &co.UserID, &co.Quantity, &co.Code); err != nil {
+				return fmt.Errorf("can't scan released reservation: %w", err)
+			}
+
+			cos = append(cos, co)
+		}
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating over released reservations: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cos, nil
+}
+
+func (i *ItemDatabase) GetSaleID(ctx context.Context, itemID int) (int, error) {
 	q := `
-		select count(*) from items
+		select sale_id from items where id = $1
 	`
+
+	var saleID int
+	if err := i.db.QueryRowContext(ctx, q, itemID).Scan(&saleID); err != nil {
+		return 0, fmt.Errorf("can't get item's sale: %w", mapError(err))
+	}
+
+	return saleID, nil
+}
+
+const itemColumns = `id, name, sale_id, sold, quantity, available_quantity, sold_quantity,
+		       price, original_price, currency, discount_percent, created_at`
+
+// itemSortTypes are types of the fields which items can be sorted by, so cursor values can be cast to them.
+var itemSortTypes = map[string]string{
+	"id":               "int",
+	"name":             "text",
+	"price":            "bigint",
+	"discount_percent": "int",
+	"created_at":       "timestamptz",
+}
+
+func (i *ItemDatabase) GetPage(ctx context.Context, filter model.ItemFilter, num, size int) ([]model.Item, int, error) {
+	var args queryArgs
+
+	where := whereClause(itemsConds(filter, time.Now(), &args))
+
+	orderBy, err := itemsOrderBy(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	q := `
+		select count(*) from items
+	` + where
 	var total int
-	if err := i.db.QueryRowContext(ctx, q).Scan(&total); err != nil {
+	if err := i.db.QueryRowContext(ctx, q, args...).Scan(&total); err != nil {
 		return nil, 0, fmt.Errorf("can't count items: %w", err)
 	}
 
 	offset := (num - 1) * size
 	q = `
-		select id, name, sale_id, sold, created_at
+		select ` + itemColumns + `
 		from items
-		order by id
-		limit $1 offset $2
-	`
-	rows, err := i.db.QueryContext(ctx, q, size, offset)
+	` + where + orderBy + `
+		limit ` + args.add(size) + ` offset ` + args.add(offset)
+	rows, err := i.db.QueryContext(ctx, q, args...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("can't query items: %w", err)
 	}
+
+	items, err := scanItems(rows, size)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return items, total, nil
+}
+
+func (i *ItemDatabase) GetPageAfter(ctx context.Context, filter model.ItemFilter, after model.Cursor, size int) ([]model.Item, *model.Cursor, error) {
+	orderBy, err := itemsOrderBy(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	field, desc := filter.SortField()
+	sort := filter.Sort
+	if sort == "" {
+		sort = field
+	}
+
+	var args queryArgs
+
+	conds := itemsConds(filter, time.Now(), &args)
+
+	if !after.IsFirst() {
+		if after.Sort != sort {
+			return nil, nil, fmt.Errorf("%w: it was issued for another sort order", model.ErrInvalidCursor)
+		}
+
+		conds = append(conds, keysetCond(field, itemSortTypes[field], desc, after, &args))
+	}
+
+	// one more item is fetched to find out whether there is the next page
+	q := `
+		select ` + itemColumns + `
+		from items
+	` + whereClause(conds) + orderBy + `
+		limit ` + args.add(size+1)
+	rows, err := i.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't query items: %w", err)
+	}
+
+	items, err := scanItems(rows, size+1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(items) <= size {
+		return items, nil, nil
+	}
+
+	items = items[:size]
+	last := items[size-1]
+
+	return items, &model.Cursor{Sort: sort, Value: itemSortValue(last, field), ID: last.ID}, nil
+}
+
+func (i *ItemDatabase) EstimateCount(ctx context.Context, filter model.ItemFilter) (int, error) {
+	var args queryArgs
+
+	q := `select 1 from items ` + whereClause(itemsConds(filter, time.Now(), &args))
+
+	return estimateCount(ctx, i.db, q, args...)
+}
+
+func scanItems(rows *sql.Rows, size int) ([]model.Item, error) {
 	defer rows.Close()
 
 	items := make([]model.Item, 0, size)
 	for rows.Next() {
 		var item model.Item
-		if err := rows.Scan(&item.ID, &item.Name, &item.SaleID, &item.Sold, &item.CreatedAt); err != nil {
-			return nil, 0, fmt.Errorf("can't scan item: %w", err)
+		err := rows.Scan(
+			&item.ID, &item.Name, &item.SaleID, &item.Sold, &item.Quantity, &item.AvailableQuantity, &item.SoldQuantity,
+			&item.Price, &item.OriginalPrice, &item.Currency, &item.DiscountPercent, &item.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan item: %w", err)
 		}
 
+		item.SetAvailability()
+
 		items = append(items, item)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, 0, fmt.Errorf("error iterating over items: %w", err)
+		return nil, fmt.Errorf("error iterating over items: %w", err)
 	}
 
-	return items, total, nil
+	return items, nil
+}
+
+// itemsConds builds conditions of items query matching the filter. Values are passed as args only.
+func itemsConds(filter model.ItemFilter, now time.Time, args *queryArgs) []string {
+	var conds []string
+
+	if filter.SaleID != 0 {
+		conds = append(conds, "sale_id = "+args.add(filter.SaleID))
+	}
+
+	if filter.Sold != nil {
+		conds = append(conds, "sold = "+args.add(*filter.Sold))
+	}
+
+	if filter.AvailableNow {
+		now := args.add(now)
+		conds = append(conds, "available_quantity > 0", "sale_start < "+now, "sale_end > "+now, "not sale_paused")
+	}
+
+	if filter.Search != "" {
+		// name is matched as a substring, so the wildcards user has typed are matched literally
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(filter.Search)
+		conds = append(conds, "name ilike "+args.add("%"+escaped+"%"))
+	}
+
+	return conds
+}
+
+// itemsOrderBy builds order by clause of items query. ID is always the last sort key,
+// so the order is stable across pages.
+func itemsOrderBy(filter model.ItemFilter) (string, error) {
+	field, desc := filter.SortField()
+	if _, ok := itemSortTypes[field]; !ok {
+		return "", model.ErrInvalidItemFilter
+	}
+
+	dir := " asc"
+	if desc {
+		dir = " desc"
+	}
+
+	if field == "id" {
+		return "order by id" + dir, nil
+	}
+
+	return "order by " + field + dir + ", id" + dir, nil
+}
+
+// itemSortValue returns value of the field of the item in the form Postgres can cast back to the field's type.
+func itemSortValue(item model.Item, field string) string {
+	switch field {
+	case "name":
+		return item.Name
+	case "price":
+		return strconv.FormatInt(item.Price, 10)
+	case "discount_percent":
+		return strconv.Itoa(item.DiscountPercent)
+	case "created_at":
+		return item.CreatedAt.Format(time.RFC3339Nano)
+	default:
+		return ""
+	}
+}
+
+func (i *ItemDatabase) GetUserOrders(ctx context.Context, userID, num, size int) ([]model.Order, int, error) {
+	q := `
+		select count(*) from orders where user_id = $1
+	`
+	var total int
+	if err := i.db.QueryRowContext(ctx, q, userID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("can't count orders: %w", err)
+	}
+
+	offset := (num - 1) * size
+	q = `
+		select id, created_at, user_id, item_id, sale_id, reservation_id, quantity, price, original_price, currency, refunded_quantity
+		from orders
+		where user_id = $1
+		order by id desc
+		limit $2 offset $3
+	`
+	rows, err := i.db.QueryContext(ctx, q, userID, size, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("can't query orders: %w", err)
+	}
+
+	orders, err := scanOrders(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return orders, total, nil
+}
+
+func (i *ItemDatabase) GetUserReservations(ctx context.Context, userID, num, size int) ([]model.Reservation, int, error) {
+	now := time.Now()
+
+	q := `
+		select count(*)
+		from reservations
+		where user_id = $1
+		  and status = 'active'
+		  and reserved_until > $2
+	`
+	var total int
+	if err := i.db.QueryRowContext(ctx, q, userID, now).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("can't count reservations: %w", err)
+	}
+
+	// code refers to the first item of the cart, see service.ItemGeneric.CheckoutCart
+	offset := (num - 1) * size
+	q = `
+		select id, created_at, item_id, user_id, quantity, code, reserved_until, extensions, status,
+		       min(item_id) over (partition by code)
+		from reservations
+		where user_id = $1
+		  and status = 'active'
+		  and reserved_until > $2
+		order by id desc
+		limit $3 offset $4
+	`
+	rows, err := i.db.QueryContext(ctx, q, userID, now, size, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("can't query reservations: %w", err)
+	}
+	defer rows.Close()
+
+	rs := make([]model.Reservation, 0, size)
+	for rows.Next() {
+		var r model.Reservation
+		err := rows.Scan(
+			&r.ID, &r.CreatedAt, &r.ItemID, &r.UserID, &r.Quantity, &r.Code.Rand, &r.ReservedUntil, &r.Extensions, &r.Status,
+			&r.Code.ItemID,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("can't scan reservation: %w", err)
+		}
+
+		r.Code.UserID = r.UserID
+		r.Code.Expires = r.ReservedUntil
+
+		rs = append(rs, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating over reservations: %w", err)
+	}
+
+	return rs, total, nil
+}
+
+func scanIDs(rows *sql.Rows) ([]int, error) {
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("can't scan id: %w", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over ids: %w", err)
+	}
+
+	return ids, nil
+}
+
+func scanCartItems(rows *sql.Rows) ([]model.CartItem, error) {
+	defer rows.Close()
+
+	var items []model.CartItem
+	for rows.Next() {
+		var item model.CartItem
+		if err := rows.Scan(&item.ItemID, &item.Quantity); err != nil {
+			return nil, fmt.Errorf("can't scan item: %w", err)
+		}
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over items: %w", err)
+	}
+
+	return items, nil
+}
+
+// scanHeldOrders scans the orders to be created for the reservations put on hold.
+func scanHeldOrders(rows *sql.Rows) ([]model.Order, error) {
+	defer rows.Close()
+
+	var orders []model.Order
+	for rows.Next() {
+		var o model.Order
+
+		err := rows.Scan(&o.ReservationID, &o.ItemID, &o.SaleID, &o.Quantity, &o.Price, &o.OriginalPrice, &o.Currency)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan held reservation: %w", err)
+		}
+
+		orders = append(orders, o)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over held reservations: %w", err)
+	}
+
+	return orders, nil
+}
+
+func scanOrders(rows *sql.Rows) ([]model.Order, error) {
+	defer rows.Close()
+
+	var orders []model.Order
+	for rows.Next() {
+		var o model.Order
+
+		err := rows.Scan(
+			&o.ID, &o.CreatedAt, &o.UserID, &o.ItemID, &o.SaleID, &o.ReservationID,
+			&o.Quantity, &o.Price, &o.OriginalPrice, &o.Currency, &o.RefundedQuantity,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan order: %w", err)
+		}
+
+		orders = append(orders, o)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over orders: %w", err)
+	}
+
+	return orders, nil
 }
@@ -4,18 +4,63 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/IlyushaZ/not-back-contest/pkg/model"
 )
 
 type SaleRepository interface {
 	GetPage(ctx context.Context, num, size int) ([]model.Sale, int, error)
+	// GetPageAfter returns up to size sales which follow the cursor, the latest first.
+	// Cursor pointing to the last of them is returned, nil if there are no more sales.
+	GetPageAfter(ctx context.Context, after model.Cursor, size int) ([]model.Sale, *model.Cursor, error)
+	// EstimateCount returns the number of sales as planner estimates it.
+	EstimateCount(ctx context.Context) (int, error)
+	Get(ctx context.Context, id int) (model.Sale, error)
+	// GetActive returns the sales whose window contains now, including paused ones, ordered by start.
+	GetActive(ctx context.Context, now time.Time) ([]model.Sale, error)
+	// GetUpcoming returns up to limit sales which start after now, the nearest first.
+	GetUpcoming(ctx context.Context, now time.Time, limit int) ([]model.Sale, error)
+	// GetStats counts units of the sales' items. Sales which have no items are omitted.
+	GetStats(ctx context.Context, ids []int) (map[int]model.SaleStats, error)
+	// Create inserts the sale along with its items and sets IDs of both.
+	Create(ctx context.Context, sale *model.Sale, items []model.Item) error
+	// UpdateWindow updates start and end of the sale as well as of all its items.
+	UpdateWindow(ctx context.Context, id int, start, end time.Time) (model.Sale, error)
+	// SetPaused pauses or resumes the sale along with all its items.
+	SetPaused(ctx context.Context, id int, paused bool) (model.Sale, error)
+	UpdateSettings(ctx context.Context, id int, settings model.SaleSettings) (model.Sale, error)
+	// Delete deletes the sale along with all its items. Sales which items have been ordered can't be deleted.
+	Delete(ctx context.Context, id int) error
 }
 
 type SaleDatabase struct {
 	DB *sql.DB
 }
 
+// saleColumns are selected in the order expected by scanSale.
+const saleColumns = `id, created_at, start_at, end_at, paused, purchases_limit, extract(epoch from checkout_timeout)::float8, items_count`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSale(row scanner) (model.Sale, error) {
+	var (
+		s               model.Sale
+		checkoutTimeout float64 // seconds
+	)
+
+	err := row.Scan(&s.ID, &s.CreatedAt, &s.StartAt, &s.EndAt, &s.Paused, &s.PurchasesLimit, &checkoutTimeout, &s.ItemsCount)
+	if err != nil {
+		return model.Sale{}, err
+	}
+
+	s.CheckoutTimeout = model.Duration(checkoutTimeout * float64(time.Second))
+
+	return s, nil
+}
+
 func (sd *SaleDatabase) GetPage(ctx context.Context, num, size int) ([]model.Sale, int, error) {
 	q := `
 		select count(*) from sales
@@ -27,7 +72,7 @@ func (sd *SaleDatabase) GetPage(ctx context.Context, num, size int) ([]model.Sal
 
 	offset := (num - 1) * size
 	q = `
-		select id, created_at, start_at, end_at
+		select ` + saleColumns + `
 		from sales
 		order by created_at desc
 		limit $1 offset $2
@@ -40,8 +85,8 @@ func (sd *SaleDatabase) GetPage(ctx context.Context, num, size int) ([]model.Sal
 
 	ss := make([]model.Sale, 0, size)
 	for rows.Next() {
-		var s model.Sale
-		if err := rows.Scan(&s.ID, &s.CreatedAt, &s.StartAt, &s.EndAt); err != nil {
+		s, err := scanSale(rows)
+		if err != nil {
 			return nil, 0, fmt.Errorf("can't scan sale: %w", err)
 		}
 
@@ -54,3 +99,338 @@ func (sd *SaleDatabase) GetPage(ctx context.Context, num, size int) ([]model.Sal
 
 	return ss, total, nil
 }
+
+// salesSort is the only order sales are listed in.
+const salesSort = "-created_at"
+
+func (sd *SaleDatabase) GetPageAfter(ctx context.Context, after model.Cursor, size int) ([]model.Sale, *model.Cursor, error) {
+	var (
+		args  queryArgs
+		conds []string
+	)
+
+	if !after.IsFirst() {
+		if after.Sort != salesSort {
+			return nil, nil, fmt.Errorf("%w: it was issued for another sort order", model.ErrInvalidCursor)
+		}
+
+		conds = append(conds, keysetCond("created_at", "timestamptz", true, after, &args))
+	}
+
+	// one more sale is fetched to find out whether there is the next page
+	q := `
+		select ` + saleColumns + `
+		from sales
+	` + whereClause(conds) + `
+		order by created_at desc, id desc
+		limit ` + args.add(size+1)
+	rows, err := sd.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't query sales: %w", err)
+	}
+	defer rows.Close()
+
+	ss := make([]model.Sale, 0, size+1)
+	for rows.Next() {
+		s, err := scanSale(rows)
+		if err != nil {
+			return nil, nil, fmt.Errorf("can't scan sale: %w", err)
+		}
+
+		ss = append(ss, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating over sales: %w", err)
+	}
+
+	if len(ss) <= size {
+		return ss, nil, nil
+	}
+
+	ss = ss[:size]
+	last := ss[size-1]
+
+	return ss, &model.Cursor{Sort: salesSort, Value: last.CreatedAt.Format(time.RFC3339Nano), ID: last.ID}, nil
+}
+
+func (sd *SaleDatabase) EstimateCount(ctx context.Context) (int, error) {
+	return estimateCount(ctx, sd.DB, `select 1 from sales`)
+}
+
+func (sd *SaleDatabase) Get(ctx context.Context, id int) (model.Sale, error) {
+	q := `
+		select ` + saleColumns + `
+		from sales
+		where id = $1
+	`
+
+	s, err := scanSale(sd.DB.QueryRowContext(ctx, q, id))
+	if err != nil {
+		return model.Sale{}, fmt.Errorf("can't get sale: %w", mapError(err))
+	}
+
+	return s, nil
+}
+
+func (sd *SaleDatabase) GetActive(ctx context.Context, now time.Time) ([]model.Sale, error) {
+	q := `
+		select ` + saleColumns + `
+		from sales
+		where start_at <= $1 and end_at > $1
+		order by start_at, id
+	`
+	rows, err := sd.DB.QueryContext(ctx, q, now)
+	if err != nil {
+		return nil, fmt.Errorf("can't query active sales: %w", err)
+	}
+
+	return scanSales(rows)
+}
+
+func (sd *SaleDatabase) GetUpcoming(ctx context.Context, now time.Time, limit int) ([]model.Sale, error) {
+	q := `
+		select ` + saleColumns + `
+		from sales
+		where start_at > $1
+		order by start_at, id
+		limit $2
+	`
+	rows, err := sd.DB.QueryContext(ctx, q, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't query upcoming sales: %w", err)
+	}
+
+	return scanSales(rows)
+}
+
+// GetStats takes reserved units as the ones which are neither available nor sold,
+// since units are taken from available ones on checkout and units written off on refund leave the stock.
+func (sd *SaleDatabase) GetStats(ctx context.Context, ids []int) (map[int]model.SaleStats, error) {
+	q := `
+		select sale_id,
+		       sum(available_quantity),
+		       sum(quantity - available_quantity - sold_quantity),
+		       sum(sold_quantity)
+		from items
+		where sale_id = any($1::int[])
+		group by sale_id
+	`
+	rows, err := sd.DB.QueryContext(ctx, q, ids)
+	if err != nil {
+		return nil, fmt.Errorf("can't count units of sales: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make(map[int]model.SaleStats, len(ids))
+	for rows.Next() {
+		var (
+			saleID int
+			st     model.SaleStats
+		)
+
+		if err := rows.Scan(&saleID, &st.Available, &st.Reserved, &st.Sold); err != nil {
+			return nil, fmt.Errorf("can't scan sale stats: %w", err)
+		}
+
+		stats[saleID] = st
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over sale stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+func scanSales(rows *sql.Rows) ([]model.Sale, error) {
+	defer rows.Close()
+
+	var ss []model.Sale
+	for rows.Next() {
+		s, err := scanSale(rows)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan sale: %w", err)
+		}
+
+		ss = append(ss, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over sales: %w", err)
+	}
+
+	return ss, nil
+}
+
+func (sd *SaleDatabase) Create(ctx context.Context, sale *model.Sale, items []model.Item) error {
+	return WithTx(sd.DB, func(tx *sql.Tx) error {
+		q := `
+			insert into sales (created_at, start_at, end_at, paused, purchases_limit, checkout_timeout, items_count)
+			values ($1, $2, $3, $4, $5, make_interval(secs => $6), $7)
+			returning id
+		`
+		sale.ItemsCount = len(items)
+
+		err := tx.QueryRowContext(ctx, q,
+			sale.CreatedAt, sale.StartAt, sale.EndAt, sale.Paused,
+			sale.PurchasesLimit, sale.CheckoutTimeout.Duration().Seconds(), sale.ItemsCount,
+		).Scan(&sale.ID)
+		if err != nil {
+			return fmt.Errorf("can't insert sale: %w", err)
+		}
+
+		if len(items) == 0 {
+			return nil
+		}
+
+		var (
+			names          = make([]string, 0, len(items))
+			quantities     = make([]int, 0, len(items))
+			prices         = make([]int64, 0, len(items))
+			originalPrices = make([]int64, 0, len(items))
+			currencies     = make([]string, 0, len(items))
+		)
+
+		for _, item := range items {
+			names = append(names, item.Name)
+			quantities = append(quantities, item.Quantity)
+			prices = append(prices, item.Price)
+			originalPrices = append(originalPrices, item.OriginalPrice)
+			currencies = append(currencies, item.Currency)
+		}
+
+		// single query instead of one per item, ids are returned in the order of names
+		q = `
+			insert into items (
+				sale_id, name, quantity, available_quantity, price, original_price, currency,
+				created_at, sale_start, sale_end, sale_paused
+			)
+			select $1, name, quantity, quantity, price, original_price, currency, $7, $8, $9, $10
+			from unnest($2::text[], $3::int[], $4::bigint[], $5::bigint[], $6::text[])
+			     with ordinality as t(name, quantity, price, original_price, currency, n)
+			order by n
+			returning id
+		`
+		rows, err := tx.QueryContext(ctx, q,
+			sale.ID, names, quantities, prices, originalPrices, currencies,
+			sale.CreatedAt, sale.StartAt, sale.EndAt, sale.Paused,
+		)
+		if err != nil {
+			return fmt.Errorf("can't insert items: %w", err)
+		}
+
+		ids, err := scanIDs(rows)
+		if err != nil {
+			return err
+		}
+
+		for i := range items {
+			items[i].ID = ids[i]
+			items[i].CreatedAt = sale.CreatedAt
+			items[i].SaleID = sale.ID
+			items[i].SaleStart = sale.StartAt
+			items[i].SaleEnd = sale.EndAt
+			items[i].AvailableQuantity = items[i].Quantity
+		}
+
+		return nil
+	})
+}
+
+func (sd *SaleDatabase) UpdateWindow(ctx context.Context, id int, start, end time.Time) (model.Sale, error) {
+	var s model.Sale
+
+	err := WithTx(sd.DB, func(tx *sql.Tx) error {
+		q := `
+			update sales
+			set start_at = $2, end_at = $3
+			where id = $1
+			returning ` + saleColumns + `
+		`
+
+		var err error
+		if s, err = scanSale(tx.QueryRowContext(ctx, q, id, start, end)); err != nil {
+			return fmt.Errorf("can't update sale: %w", mapError(err))
+		}
+
+		q = `
+			update items
+			set sale_start = $2, sale_end = $3
+			where sale_id = $1
+		`
+		if _, err := tx.ExecContext(ctx, q, id, start, end); err != nil {
+			return fmt.Errorf("can't update sale's items: %w", err)
+		}
+
+		return nil
+	})
+
+	return s, err
+}
+
+func (sd *SaleDatabase) SetPaused(ctx context.Context, id int, paused bool) (model.Sale, error) {
+	var s model.Sale
+
+	err := WithTx(sd.DB, func(tx *sql.Tx) error {
+		q := `
+			update sales
+			set paused = $2
+			where id = $1
+			returning ` + saleColumns + `
+		`
+
+		var err error
+		if s, err = scanSale(tx.QueryRowContext(ctx, q, id, paused)); err != nil {
+			return fmt.Errorf("can't update sale: %w", mapError(err))
+		}
+
+		q = `
+			update items
+			set sale_paused = $2
+			where sale_id = $1
+		`
+		if _, err := tx.ExecContext(ctx, q, id, paused); err != nil {
+			return fmt.Errorf("can't update sale's items: %w", err)
+		}
+
+		return nil
+	})
+
+	return s, err
+}
+
+func (sd *SaleDatabase) UpdateSettings(ctx context.Context, id int, settings model.SaleSettings) (model.Sale, error) {
+	q := `
+		update sales
+		set purchases_limit = $2, checkout_timeout = make_interval(secs => $3)
+		where id = $1
+		returning ` + saleColumns + `
+	`
+
+	s, err := scanSale(sd.DB.QueryRowContext(ctx, q, id, settings.PurchasesLimit, settings.CheckoutTimeout.Duration().Seconds()))
+	if err != nil {
+		return model.Sale{}, fmt.Errorf("can't update sale settings: %w", mapError(err))
+	}
+
+	return s, nil
+}
+
+func (sd *SaleDatabase) Delete(ctx context.Context, id int) error {
+	q := `
+		delete from sales
+		where id = $1
+	`
+	res, err := sd.DB.ExecContext(ctx, q, id)
+	if err != nil {
+		return fmt.Errorf("can't delete sale: %w", mapError(err))
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("can't get affected rows: %w", err)
+	} else if affected == 0 {
+		return fmt.Errorf("can't delete sale: %w", ErrNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,297 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	channel         = "events:items"
+	seqKeyPrefix    = "events:seq:"
+	seqTTL          = 7 * 24 * time.Hour
+	publishTimeout  = time.Second
+	idleStreamTTL   = 10 * time.Minute
+	cleanupInterval = time.Minute
+	// publishQueueSize is the number of events which may wait to be published before new ones are dropped.
+	publishQueueSize = 1024
+)
+
+// publishScript assigns the event its ID and publishes it in one step,
+// so the events of the sale are delivered in the order of their IDs.
+var publishScript = redis.NewScript(`
+	local id = redis.call('INCR', KEYS[1])
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	redis.call('PUBLISH', ARGV[1], id .. ' ' .. ARGV[2])
+	return id
+`)
+
+// Bus delivers events of the sales to subscribers of every instance.
+// Events are published to redis, each instance receives them in Run and fans them out to its own subscribers.
+// The latest events of each sale are kept in memory, so subscribers can resume after reconnecting.
+//
+// Subscribers which don't keep up with the events are dropped rather than slowing down the others,
+// they are expected to reconnect and resume from the last event they've got.
+type Bus struct {
+	redis *redis.Client
+	// queue keeps the events to be published in the order of Publish calls.
+	queue chan Event
+	// history is the number of the latest events kept per sale.
+	history int
+	// buffer is the number of events which may be queued for a subscriber before it's dropped.
+	buffer int
+
+	mu    sync.Mutex
+	sales map[int]*stream
+}
+
+type stream struct {
+	events     []Event // the latest ones, ordered by ID
+	lastID     int64
+	subs       map[*Subscription]struct{}
+	receivedAt time.Time
+}
+
+// Subscription receives events of the sale from C until it's closed,
+// which happens either on Close or when subscriber falls behind.
+type Subscription struct {
+	C <-chan Event
+
+	ch     chan Event
+	saleID int
+	bus    *Bus
+	once   sync.Once
+}
+
+func NewBus(redis *redis.Client, history, buffer int) *Bus {
+	return &Bus{
+		redis:   redis,
+		queue:   make(chan Event, publishQueueSize),
+		history: history,
+		buffer:  buffer,
+		sales:   make(map[int]*stream),
+	}
+}
+
+// Publish queues the events to be published by Run, so it doesn't slow down the caller.
+// Events are published one by one in the order they are queued, so their IDs follow that order.
+// If the queue is full, the events are dropped, and the subscribers get reset once the sequence is seen broken.
+// Errors are only logged: the stream is best-effort, while the source of truth is the database.
+func (b *Bus) Publish(events ...Event) {
+	for _, e := range events {
+		if e.At.IsZero() {
+			e.At = time.Now()
+		}
+
+		select {
+		case b.queue <- e:
+		default:
+			slog.Warn("events queue is full, dropping event", slog.Int("sale_id", e.SaleID), slog.String("kind", string(e.Kind)))
+		}
+	}
+}
+
+// publish publishes the queued events until ctx is done.
+func (b *Bus) publish(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case e := <-b.queue:
+			payload, err := json.Marshal(e)
+			if err != nil {
+				slog.Error("can't marshal event", slog.Any("error", err))
+				continue
+			}
+
+			pctx, cancel := context.WithTimeout(ctx, publishTimeout)
+			key := seqKeyPrefix + strconv.Itoa(e.SaleID)
+
+			if err := publishScript.Run(pctx, b.redis, []string{key}, channel, payload, seqTTL.Milliseconds()).Err(); err != nil {
+				slog.Error("can't publish event", slog.Any("error", err))
+			}
+
+			cancel()
+		}
+	}
+}
+
+// Run publishes the queued events, receives events published by all the instances and blocks until ctx is done.
+func (b *Bus) Run(ctx context.Context) {
+	go b.publish(ctx)
+
+	pubsub := b.redis.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	cleanup := time.NewTicker(cleanupInterval)
+	defer cleanup.Stop()
+
+	msgs := pubsub.Channel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-cleanup.C:
+			b.cleanup()
+
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+
+			e, err := parseMessage(msg.Payload)
+			if err != nil {
+				slog.Error("can't parse event", slog.Any("error", err))
+				continue
+			}
+
+			b.dispatch(e)
+		}
+	}
+}
+
+// Subscribe subscribes to the events of the sale. If lastID is set, the events following it
+// which are still kept are returned to be sent before the ones from the subscription.
+// If some of them aren't kept anymore (or it can't be told), reset is true.
+func (b *Bus) Subscribe(saleID int, lastID int64) (sub *Subscription, backlog []Event, reset bool) {
+	ch := make(chan Event, b.buffer)
+	sub = &Subscription{C: ch, ch: ch, saleID: saleID, bus: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := b.stream(saleID)
+	s.subs[sub] = struct{}{}
+
+	if lastID == 0 || lastID == s.lastID {
+		return sub, nil, false
+	}
+
+	if len(s.events) == 0 || lastID < s.events[0].ID-1 || lastID > s.lastID {
+		return sub, nil, true
+	}
+
+	for _, e := range s.events {
+		if e.ID > lastID {
+			backlog = append(backlog, e)
+		}
+	}
+
+	return sub, backlog, false
+}
+
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if st, ok := s.bus.sales[s.saleID]; ok {
+		delete(st.subs, s)
+	}
+
+	s.close()
+}
+
+func (s *Subscription) close() {
+	s.once.Do(func() { close(s.ch) })
+}
+
+func (b *Bus) dispatch(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := b.stream(e.SaleID)
+	s.receivedAt = time.Now()
+
+	switch {
+	case e.ID == s.lastID:
+		// redelivered
+		return
+
+	case e.ID < s.lastID, s.lastID != 0 && e.ID != s.lastID+1:
+		// the sequence has started over or events have been lost while redis was unavailable,
+		// so the kept ones can't be resumed from and the subscribers have to refetch the state
+		slog.Warn("events sequence broken", slog.Int("sale_id", e.SaleID), slog.Int64("last_id", s.lastID), slog.Int64("id", e.ID))
+
+		s.events = s.events[:0]
+		b.send(s, Event{ID: e.ID - 1, Kind: KindReset, SaleID: e.SaleID, At: s.receivedAt})
+	}
+
+	s.lastID = e.ID
+
+	s.events = append(s.events, e)
+	if len(s.events) > b.history {
+		s.events = s.events[len(s.events)-b.history:]
+	}
+
+	b.send(s, e)
+}
+
+// send sends the event to the subscribers of the stream, dropping the ones which don't keep up.
+// Must be called with mu held.
+func (b *Bus) send(s *stream, e Event) {
+	for sub := range s.subs {
+		select {
+		case sub.ch <- e:
+		default:
+			slog.Debug("dropping slow subscriber", slog.Int("sale_id", e.SaleID))
+			delete(s.subs, sub)
+			sub.close()
+		}
+	}
+}
+
+// stream returns the stream of the sale creating it if needed. Must be called with mu held.
+func (b *Bus) stream(saleID int) *stream {
+	s, ok := b.sales[saleID]
+	if !ok {
+		s = &stream{subs: make(map[*Subscription]struct{}), receivedAt: time.Now()}
+		b.sales[saleID] = s
+	}
+
+	return s
+}
+
+// cleanup drops the streams which nobody listens to and which have had no events for a while.
+func (b *Bus) cleanup() {
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for id, s := range b.sales {
+		if len(s.subs) == 0 && now.Sub(s.receivedAt) > idleStreamTTL {
+			delete(b.sales, id)
+		}
+	}
+}
+
+func parseMessage(payload string) (Event, error) {
+	id, data, ok := strings.Cut(payload, " ")
+	if !ok {
+		return Event{}, fmt.Errorf("expected message to be in \"<id> <event>\" format, got %q", payload)
+	}
+
+	var e Event
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		return Event{}, fmt.Errorf("can't unmarshal event: %w", err)
+	}
+
+	var err error
+
+	e.ID, err = strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return Event{}, fmt.Errorf("can't parse event id: %w", err)
+	}
+
+	return e, nil
+}
@@ -0,0 +1,29 @@
+package events
+
+import "time"
+
+// Kind tells what happened to the units of the item.
+type Kind string
+
+const (
+	KindReserved Kind = "reserved"
+	// KindReleased means that units are back in stock: the reservation was cancelled or has expired,
+	// or the units were refunded and put back on sale.
+	KindReleased Kind = "released"
+	KindSold     Kind = "sold"
+	// KindReset is never published, it's sent to subscribers which may have missed some events,
+	// so they have to refetch the state of the sale.
+	KindReset Kind = "reset"
+)
+
+// Event is a change of item's stock within the sale.
+type Event struct {
+	// ID is a sequence number of the event within the sale assigned on publishing,
+	// so it's the same on every instance and can be used to resume the stream.
+	ID       int64     `json:"id,omitempty"`
+	Kind     Kind      `json:"kind"`
+	SaleID   int       `json:"sale_id"`
+	ItemID   int       `json:"item_id,omitempty"`
+	Quantity int       `json:"quantity,omitempty"`
+	At       time.Time `json:"at"`
+}
@@ -0,0 +1,148 @@
+// Package idempotency keeps responses to requests made with idempotency keys, so retries of a request
+// get the response of the first attempt instead of being made again.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrInProgress = errors.New("request with the same idempotency key is in progress")
+	ErrMismatch   = errors.New("idempotency key has been used for another request")
+)
+
+const (
+	// lockTTL bounds how long the key stays locked if the instance making the request dies before completing it.
+	lockTTL = 30 * time.Second
+	// pollInterval is how often the key locked by another request is checked.
+	pollInterval = 50 * time.Millisecond
+	// purgeInterval is how often expired keys are deleted from the database.
+	purgeInterval = time.Minute
+)
+
+// Response is the response saved for the key.
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// Backend keeps keys along with fingerprints of the requests they were used for and the responses to them.
+type Backend interface {
+	// Begin locks the key for the request with given fingerprint for lockTTL. If the key has been completed,
+	// its response is returned instead. ErrInProgress is returned if the key is locked by another request,
+	// ErrMismatch if the key has been used for the request with another fingerprint.
+	Begin(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*Response, error)
+	// Complete saves the response for the key for ttl.
+	Complete(ctx context.Context, key, fingerprint string, resp Response, ttl time.Duration) error
+	// Abort unlocks the key which hasn't been completed, so the request can be made again.
+	Abort(ctx context.Context, key, fingerprint string) error
+}
+
+// PurgingBackend is the Backend which doesn't expire keys by itself.
+type PurgingBackend interface {
+	Backend
+	// DeleteExpired deletes the keys which have expired and returns their number.
+	DeleteExpired(ctx context.Context) (int, error)
+}
+
+// Store keeps keys in Redis and falls back to the database if Redis fails, so keys are honoured while it's unavailable.
+// Keys kept in one of them are not seen in the other, so the request retried right when Redis goes down may be made twice.
+type Store struct {
+	Redis Backend
+	DB    PurgingBackend
+	// TTL is how long responses are kept.
+	TTL time.Duration
+	// Wait is how long the request waits for another one made with the same key before ErrInProgress is returned.
+	Wait time.Duration
+}
+
+// Lock is held by the request which is being made with the key. Either Complete or Abort must be called once it's made.
+type Lock struct {
+	backend     Backend
+	key         string
+	fingerprint string
+	ttl         time.Duration
+}
+
+// Acquire locks the key for the request with given fingerprint. If the key has been completed, its response is returned
+// instead of the lock. If the key is locked by another request, it's waited for to be either completed or aborted.
+func (s *Store) Acquire(ctx context.Context, key, fingerprint string) (*Lock, *Response, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, s.Wait)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		backend, resp, err := s.begin(waitCtx, key, fingerprint)
+		switch {
+		case err == nil && resp != nil:
+			return nil, resp, nil
+		case err == nil:
+			return &Lock{backend: backend, key: key, fingerprint: fingerprint, ttl: s.TTL}, nil, nil
+		case !errors.Is(err, ErrInProgress):
+			return nil, nil, err
+		}
+
+		select {
+		case <-waitCtx.Done():
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+
+			return nil, nil, ErrInProgress
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Store) begin(ctx context.Context, key, fingerprint string) (Backend, *Response, error) {
+	resp, err := s.Redis.Begin(ctx, key, fingerprint, lockTTL)
+	if err == nil || errors.Is(err, ErrInProgress) || errors.Is(err, ErrMismatch) {
+		return s.Redis, resp, err
+	}
+
+	slog.Warn("can't lock idempotency key in redis, falling back to database", slog.Any("error", err))
+
+	resp, err = s.DB.Begin(ctx, key, fingerprint, lockTTL)
+
+	return s.DB, resp, err
+}
+
+// Run purges expired keys from the database, blocks until ctx is done.
+func (s *Store) Run(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.DB.DeleteExpired(ctx)
+			if err != nil {
+				slog.Error("can't delete expired idempotency keys", slog.Any("error", err))
+				continue
+			}
+
+			if n > 0 {
+				slog.Debug("deleted expired idempotency keys", slog.Int("count", n))
+			}
+		}
+	}
+}
+
+// Complete saves the response, so the retries of the request get it.
+func (l *Lock) Complete(ctx context.Context, resp Response) error {
+	return l.backend.Complete(ctx, l.key, l.fingerprint, resp, l.ttl)
+}
+
+// Abort unlocks the key without saving the response, so the request may be retried.
+func (l *Lock) Abort(ctx context.Context) error {
+	return l.backend.Abort(ctx, l.key, l.fingerprint)
+}
@@ -0,0 +1,105 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	cacheKeyPrefix = "idempotency:"
+	// pendingPrefix marks the value of the key locked by the request in progress, it's followed by the fingerprint.
+	pendingPrefix = "pending:"
+	redisTimeout  = 300 * time.Millisecond
+)
+
+// beginScript sets the pending value unless the key exists and returns the existing value otherwise.
+var beginScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return false
+end
+return redis.call('GET', KEYS[1])
+`)
+
+// abortScript deletes the key only if it's still locked by the request, so it doesn't unlock the completed one.
+var abortScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+type redisEntry struct {
+	Fingerprint string   `json:"fingerprint"`
+	Response    Response `json:"response"`
+}
+
+// RedisBackend keeps keys in Redis, where they expire by themselves.
+type RedisBackend struct {
+	Redis *redis.Client
+}
+
+func (rb *RedisBackend) Begin(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	val, err := beginScript.Run(ctx, rb.Redis, []string{cacheKeyPrefix + key}, pendingPrefix+fingerprint, lockTTL.Milliseconds()).Text()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("can't lock key: %w", err)
+	}
+
+	if fp, ok := strings.CutPrefix(val, pendingPrefix); ok {
+		if fp != fingerprint {
+			return nil, ErrMismatch
+		}
+
+		return nil, ErrInProgress
+	}
+
+	var entry redisEntry
+	if err := json.Unmarshal([]byte(val), &entry); err != nil {
+		return nil, fmt.Errorf("can't decode saved response: %w", err)
+	}
+
+	if entry.Fingerprint != fingerprint {
+		return nil, ErrMismatch
+	}
+
+	return &entry.Response, nil
+}
+
+func (rb *RedisBackend) Complete(ctx context.Context, key, fingerprint string, resp Response, ttl time.Duration) error {
+	val, err := json.Marshal(redisEntry{Fingerprint: fingerprint, Response: resp})
+	if err != nil {
+		return fmt.Errorf("can't encode response: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	if err := rb.Redis.Set(ctx, cacheKeyPrefix+key, val, ttl).Err(); err != nil {
+		return fmt.Errorf("can't save response: %w", err)
+	}
+
+	return nil
+}
+
+func (rb *RedisBackend) Abort(ctx context.Context, key, fingerprint string) error {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	if err := abortScript.Run(ctx, rb.Redis, []string{cacheKeyPrefix + key}, pendingPrefix+fingerprint).Err(); err != nil {
+		return fmt.Errorf("can't unlock key: %w", err)
+	}
+
+	return nil
+}
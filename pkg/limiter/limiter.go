@@ -2,65 +2,264 @@ package limiter
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"strconv"
 	"time"
 
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
 	"github.com/redis/go-redis/v9"
 )
 
 const cacheKeyPrefix = "limiter:"
 
+// counterTTLAfterSale is how long user's counter is kept after the end of the sale,
+// so that it survives the sale window being moved a bit.
+const counterTTLAfterSale = 24 * time.Hour
+
 const redisTimeout = 300 * time.Millisecond
 
+// User's quota is kept in a hash with the fields:
+//   - "p:<sale id>" for units purchased within the sale;
+//   - "r:<sale id>:<reservation id>" for units reserved within the sale.
+//
+// Values are "<units>:<expiration in ms>", expired fields are dropped by the scripts when they come across them.
+// Everything is done by scripts, so checking the quota and reserving it is atomic.
+const scriptPrelude = `
+local key = KEYS[1]
+
+-- expire keeps the key as long as its longest living field
+local function expire(at)
+	local current = redis.call('PEXPIRETIME', key)
+	if current < 0 or current < tonumber(at) then
+		redis.call('PEXPIREAT', key, at)
+	end
+end
+
+local function parse(v)
+	local n, at = string.match(v, '^(%d+):(%d+)$')
+	return tonumber(n), tonumber(at)
+end
+
+local function add_purchased(sale, n, at)
+	local field = 'p:' .. sale
+	local v = redis.call('HGET', key, field)
+	local current = v and parse(v) or 0
+
+	if current + n <= 0 then
+		redis.call('HDEL', key, field)
+		return
+	end
+
+	redis.call('HSET', key, field, (current + n) .. ':' .. at)
+	expire(at)
+end
+
+-- migrate moves the counter of purchases kept before reservations were introduced into the hash
+local function migrate(sale, at)
+	local legacy = redis.call('GET', KEYS[2])
+	if legacy then
+		redis.call('DEL', KEYS[2])
+		add_purchased(sale, tonumber(legacy), at)
+	end
+end
+`
+
+// reserveScript reserves units unless it takes user over the limit. Otherwise, it returns the nearest expiration of
+// user's reservations within the sale or -1 if the purchases alone leave no room for the units.
+var reserveScript = redis.NewScript(scriptPrelude + `
+local now, sale, id, n, limit, expires, sale_expires = tonumber(ARGV[1]), ARGV[2], ARGV[3], tonumber(ARGV[4]), tonumber(ARGV[5]), ARGV[6], ARGV[7]
+
+migrate(sale, sale_expires)
+
+local purchased, reserved, nearest = 0, 0, nil
+local prefix = 'r:' .. sale .. ':'
+
+local fields = redis.call('HGETALL', key)
+for i = 1, #fields, 2 do
+	local units, at = parse(fields[i + 1])
+	if at <= now then
+		redis.call('HDEL', key, fields[i])
+	elseif fields[i] == 'p:' .. sale then
+		purchased = units
+	elseif string.sub(fields[i], 1, #prefix) == prefix then
+		reserved = reserved + units
+		if not nearest or at < nearest then
+			nearest = at
+		end
+	end
+end
+
+if purchased + n > limit then
+	return -1
+end
+
+if purchased + reserved + n > limit then
+	return nearest
+end
+
+redis.call('HSET', key, prefix .. id, n .. ':' .. expires)
+expire(expires)
+
+return 0
+`)
+
+// renameScript moves the reservations of all the sales made under one id to another.
+var renameScript = redis.NewScript(scriptPrelude + `
+local suffix, id = ':' .. ARGV[1], ARGV[2]
+
+local fields = redis.call('HGETALL', key)
+for i = 1, #fields, 2 do
+	local f = fields[i]
+	if string.sub(f, 1, 2) == 'r:' and string.sub(f, -#suffix) == suffix then
+		redis.call('HDEL', key, f)
+		redis.call('HSET', key, string.sub(f, 1, -#suffix - 1) .. ':' .. id, fields[i + 1])
+	end
+end
+
+return 0
+`)
+
+// releaseScript deletes the reservations of all the sales made under the id.
+var releaseScript = redis.NewScript(scriptPrelude + `
+local suffix = ':' .. ARGV[1]
+
+local fields = redis.call('HGETALL', key)
+for i = 1, #fields, 2 do
+	local f = fields[i]
+	if string.sub(f, 1, 2) == 'r:' and string.sub(f, -#suffix) == suffix then
+		redis.call('HDEL', key, f)
+	end
+end
+
+return 0
+`)
+
+// commitScript turns the reservation within the sale into n purchases. They are counted even if there is no such
+// reservation, e.g. it has expired right before the purchase.
+var commitScript = redis.NewScript(scriptPrelude + `
+local sale, id, n, sale_expires = ARGV[1], ARGV[2], tonumber(ARGV[3]), ARGV[4]
+
+migrate(sale, sale_expires)
+
+redis.call('HDEL', key, 'r:' .. sale .. ':' .. id)
+add_purchased(sale, n, sale_expires)
+
+return 0
+`)
+
+// decrementScript takes n purchases back. Counter which has already expired is left as is,
+// so the user doesn't get more than the limit.
+var decrementScript = redis.NewScript(scriptPrelude + `
+local sale, n, sale_expires = ARGV[1], tonumber(ARGV[2]), ARGV[3]
+
+migrate(sale, sale_expires)
+
+if redis.call('HEXISTS', key, 'p:' .. sale) == 1 then
+	add_purchased(sale, -n, sale_expires)
+end
+
+return 0
+`)
+
+// Limiter keeps user's quota of purchases per sale. Limits are taken from the sales themselves.
+//
+// Units are reserved on checkout, so the quota is never exceeded by concurrent requests: reserved units are either
+// turned into purchases or released on cancel and expiration. Reservations also expire by themselves
+// at the time they are made for, in case they are not released explicitly.
 type Limiter struct {
 	Redis *redis.Client
-	Limit int
 }
 
-func (l *Limiter) Increment(ctx context.Context, userID int) (int, error) {
-	key := userCounterKey(userID)
-
-	var cancel context.CancelFunc
-	ctx, cancel = context.WithTimeout(ctx, redisTimeout)
+// Reserve reserves n units of user's quota for the sale under id until given time. If there is not enough quota left,
+// false is returned along with the time the nearest of user's reservations expires at, or zero time if the quota is
+// taken by purchases, which are given back only on refund.
+func (l *Limiter) Reserve(ctx context.Context, userID int, sale model.Sale, id string, n int, until time.Time) (bool, time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
 	defer cancel()
 
-	val, err := l.Redis.Incr(ctx, key).Result()
+	keys := []string{userKey(userID), legacyCounterKey(userID, sale.ID)}
+	args := []any{time.Now().UnixMilli(), sale.ID, id, n, sale.PurchasesLimit, until.UnixMilli(), saleExpiration(sale)}
+
+	res, err := reserveScript.Run(ctx, l.Redis, keys, args...).Int64()
 	if err != nil {
-		return 0, fmt.Errorf("can't increment user's counter: %w", err)
+		return false, time.Time{}, fmt.Errorf("can't reserve user's quota: %w", err)
 	}
 
-	if val == 1 {
-		if err := l.Redis.Expire(ctx, key, time.Hour).Err(); err != nil {
-			return 0, fmt.Errorf("can't set counter expiration: %w", err)
-		}
+	switch {
+	case res == 0:
+		return true, time.Time{}, nil
+	case res < 0:
+		return false, time.Time{}, nil
+	default:
+		return false, time.UnixMilli(res), nil
+	}
+}
+
+// Rename moves the reservations made under id to newID, e.g. once checkout code is known.
+func (l *Limiter) Rename(ctx context.Context, userID int, id, newID string) error {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	if err := renameScript.Run(ctx, l.Redis, []string{userKey(userID)}, id, newID).Err(); err != nil {
+		return fmt.Errorf("can't rename user's reservation: %w", err)
 	}
 
-	return int(val), nil
+	return nil
 }
 
-func (l *Limiter) LimitExceeded(ctx context.Context, userID int) (bool, error) {
-	var cancel context.CancelFunc
-	ctx, cancel = context.WithTimeout(ctx, redisTimeout)
+// Release gives the units reserved under id back to user's quota for all the sales.
+func (l *Limiter) Release(ctx context.Context, userID int, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
 	defer cancel()
 
-	c, err := l.Redis.Get(ctx, userCounterKey(userID)).Int()
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return false, nil
-		}
+	if err := releaseScript.Run(ctx, l.Redis, []string{userKey(userID)}, id).Err(); err != nil {
+		return fmt.Errorf("can't release user's reservation: %w", err)
+	}
 
-		return false, err
+	return nil
+}
+
+// Commit turns the units reserved under id for the sale into n purchases.
+func (l *Limiter) Commit(ctx context.Context, userID int, sale model.Sale, id string, n int) error {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	keys := []string{userKey(userID), legacyCounterKey(userID, sale.ID)}
+
+	if err := commitScript.Run(ctx, l.Redis, keys, sale.ID, id, n, saleExpiration(sale)).Err(); err != nil {
+		return fmt.Errorf("can't commit user's reservation: %w", err)
 	}
 
-	return c > l.Limit, nil
+	return nil
+}
+
+// Decrement takes n purchases back from user's counter for the sale.
+// Counter which has already expired is left as is, so the user doesn't get more than the limit.
+func (l *Limiter) Decrement(ctx context.Context, userID int, sale model.Sale, n int) error {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	keys := []string{userKey(userID), legacyCounterKey(userID, sale.ID)}
+
+	if err := decrementScript.Run(ctx, l.Redis, keys, sale.ID, n, saleExpiration(sale)).Err(); err != nil {
+		return fmt.Errorf("can't decrement user's counter: %w", err)
+	}
+
+	return nil
+}
+
+// saleExpiration returns time in ms until which user's purchases within the sale are counted.
+func saleExpiration(sale model.Sale) int64 {
+	return sale.EndAt.Add(counterTTLAfterSale).UnixMilli()
+}
+
+// userKey builds key which is used to store user's quota of all the sales.
+// Sales may have any duration and overlap, so the fields of the key are prefixed with sale's ID.
+func userKey(userID int) string {
+	return cacheKeyPrefix + strconv.Itoa(userID)
 }
 
-// userCounterKey builds key which is used to store count of user's purchases per sale.
-// It consists of user's ID concatenated to current timestamp rounded down to current hour,
-// which is the start of the sale.
-func userCounterKey(userID int) string {
-	now := time.Now().Truncate(time.Hour).Unix()
-	return cacheKeyPrefix + strconv.Itoa(userID) + ":" + strconv.FormatInt(now, 10)
+// legacyCounterKey builds key which was used to store count of user's purchases per sale.
+func legacyCounterKey(userID, saleID int) string {
+	return cacheKeyPrefix + strconv.Itoa(userID) + ":" + strconv.Itoa(saleID)
 }
@@ -0,0 +1,244 @@
+package limiter
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const userID = 1
+
+func newTestLimiter(t *testing.T) (*Limiter, *miniredis.Miniredis) {
+	t.Helper()
+
+	m := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return &Limiter{Redis: client}, m
+}
+
+func testSale(limit int) model.Sale {
+	now := time.Now()
+
+	sale := model.Sale{
+		StartAt:         now.Add(-time.Hour),
+		EndAt:           now.Add(time.Hour),
+		PurchasesLimit:  limit,
+		CheckoutTimeout: model.Duration(time.Minute),
+	}
+	sale.ID = 5
+
+	return sale
+}
+
+func reserve(t *testing.T, l *Limiter, sale model.Sale, id string, n int) (bool, time.Time) {
+	t.Helper()
+
+	ok, retryAt, err := l.Reserve(context.Background(), userID, sale, id, n, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Reserve() unexpected error: %v", err)
+	}
+
+	return ok, retryAt
+}
+
+func TestLimiter_ReserveConcurrent(t *testing.T) {
+	l, _ := newTestLimiter(t)
+	sale := testSale(3)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		reserved  int
+		retryAts  []time.Time
+		requests  = 20
+		startedAt = time.Now()
+	)
+
+	for i := range requests {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			ok, retryAt, err := l.Reserve(context.Background(), userID, sale, "id"+strconv.Itoa(i), 1, startedAt.Add(time.Minute))
+			if err != nil {
+				t.Errorf("Reserve() unexpected error: %v", err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if ok {
+				reserved++
+			} else {
+				retryAts = append(retryAts, retryAt)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if reserved != sale.PurchasesLimit {
+		t.Fatalf("expected exactly %d reservations to succeed, got %d", sale.PurchasesLimit, reserved)
+	}
+
+	for _, retryAt := range retryAts {
+		// the quota is taken by reservations, so it's back once the nearest of them expires
+		if retryAt.UnixMilli() != startedAt.Add(time.Minute).UnixMilli() {
+			t.Errorf("expected retry at %v, got %v", startedAt.Add(time.Minute), retryAt)
+		}
+	}
+}
+
+func TestLimiter_RenameAndCommit(t *testing.T) {
+	l, m := newTestLimiter(t)
+	sale := testSale(3)
+	ctx := context.Background()
+
+	if ok, _ := reserve(t, l, sale, "tmp", 2); !ok {
+		t.Fatal("expected reservation to succeed")
+	}
+
+	if err := l.Rename(ctx, userID, "tmp", "code"); err != nil {
+		t.Fatalf("Rename() unexpected error: %v", err)
+	}
+
+	if m.HGet(userKey(userID), "r:5:tmp") != "" || m.HGet(userKey(userID), "r:5:code") == "" {
+		t.Fatalf("expected reservation to be renamed, got fields %v", hkeys(m))
+	}
+
+	if err := l.Commit(ctx, userID, sale, "code", 2); err != nil {
+		t.Fatalf("Commit() unexpected error: %v", err)
+	}
+
+	if fields := hkeys(m); len(fields) != 1 || fields[0] != "p:5" {
+		t.Fatalf("expected reservation to be turned into purchases, got fields %v", fields)
+	}
+
+	// purchases are given back only on refund, so no retry time is known
+	ok, retryAt := reserve(t, l, sale, "another", 2)
+	if ok || !retryAt.IsZero() {
+		t.Fatalf("expected reservation to be rejected by purchases, got ok = %v, retry at %v", ok, retryAt)
+	}
+
+	if ok, _ := reserve(t, l, sale, "another", 1); !ok {
+		t.Fatal("expected the rest of the quota to be reserved")
+	}
+}
+
+func TestLimiter_Release(t *testing.T) {
+	l, _ := newTestLimiter(t)
+	sale := testSale(3)
+
+	if ok, _ := reserve(t, l, sale, "code", 3); !ok {
+		t.Fatal("expected reservation to succeed")
+	}
+
+	if ok, retryAt := reserve(t, l, sale, "another", 1); ok || retryAt.IsZero() {
+		t.Fatalf("expected reservation to be rejected until the first one expires, got ok = %v, retry at %v", ok, retryAt)
+	}
+
+	if err := l.Release(context.Background(), userID, "code"); err != nil {
+		t.Fatalf("Release() unexpected error: %v", err)
+	}
+
+	if ok, _ := reserve(t, l, sale, "another", 3); !ok {
+		t.Fatal("expected released quota to be reserved again")
+	}
+}
+
+func TestLimiter_ReservationExpires(t *testing.T) {
+	l, m := newTestLimiter(t)
+	sale := testSale(1)
+	ctx := context.Background()
+
+	ok, _, err := l.Reserve(ctx, userID, sale, "code", 1, time.Now().Add(50*time.Millisecond))
+	if err != nil || !ok {
+		t.Fatalf("expected reservation to succeed, got ok = %v, err = %v", ok, err)
+	}
+
+	if ttl := m.TTL(userKey(userID)); ttl <= 0 || ttl > 50*time.Millisecond {
+		t.Errorf("expected key to expire along with the reservation, got TTL %v", ttl)
+	}
+
+	if ok, _ := reserve(t, l, sale, "another", 1); ok {
+		t.Fatal("expected reservation to be rejected while the first one is held")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if ok, _ := reserve(t, l, sale, "another", 1); !ok {
+		t.Fatal("expected expired reservation not to be counted")
+	}
+
+	if fields := hkeys(m); len(fields) != 1 || fields[0] != "r:5:another" {
+		t.Errorf("expected expired field to be dropped, got fields %v", fields)
+	}
+}
+
+func TestLimiter_MigratesLegacyCounter(t *testing.T) {
+	l, m := newTestLimiter(t)
+	sale := testSale(3)
+
+	m.Set(legacyCounterKey(userID, sale.ID), "2")
+
+	if ok, retryAt := reserve(t, l, sale, "code", 2); ok || !retryAt.IsZero() {
+		t.Fatalf("expected legacy purchases to be counted, got ok = %v, retry at %v", ok, retryAt)
+	}
+
+	if m.Exists(legacyCounterKey(userID, sale.ID)) {
+		t.Error("expected legacy counter to be deleted")
+	}
+
+	if got := m.HGet(userKey(userID), "p:5"); got != "2:"+strconv.FormatInt(saleExpiration(sale), 10) {
+		t.Errorf("expected legacy purchases to be moved to the hash, got %q", got)
+	}
+
+	if ok, _ := reserve(t, l, sale, "code", 1); !ok {
+		t.Fatal("expected the rest of the quota to be reserved")
+	}
+}
+
+func TestLimiter_Decrement(t *testing.T) {
+	l, m := newTestLimiter(t)
+	sale := testSale(2)
+	ctx := context.Background()
+
+	if err := l.Commit(ctx, userID, sale, "code", 2); err != nil {
+		t.Fatalf("Commit() unexpected error: %v", err)
+	}
+
+	if err := l.Decrement(ctx, userID, sale, 1); err != nil {
+		t.Fatalf("Decrement() unexpected error: %v", err)
+	}
+
+	if ok, _ := reserve(t, l, sale, "another", 1); !ok {
+		t.Fatal("expected refunded unit to be reserved again")
+	}
+
+	// counter which is gone is not recreated, so it never goes negative
+	m.Del(userKey(userID))
+
+	if err := l.Decrement(ctx, userID, sale, 1); err != nil {
+		t.Fatalf("Decrement() unexpected error: %v", err)
+	}
+
+	if m.Exists(userKey(userID)) {
+		t.Errorf("expected no counter to be created, got fields %v", hkeys(m))
+	}
+}
+
+func hkeys(m *miniredis.Miniredis) []string {
+	fields, _ := m.HKeys(userKey(userID))
+	return fields
+}
@@ -1,70 +1,63 @@
 package model
 
 import (
-	"fmt"
-	"math/rand"
-	"strconv"
-	"strings"
+	"errors"
 	"time"
 )
 
 const (
-	DefaultCheckoutTimeout = 30 * time.Second
-	CheckoutCodeLen        = 8
+	DefaultCheckoutTimeout       = 30 * time.Second
+	DefaultMaxCheckoutExtensions = 3
+)
+
+var (
+	ErrExtensionsExceeded = errors.New("checkout can't be extended anymore")
+)
+
+// CheckoutKind tells what happened to the reservation in a record of checkouts table.
+type CheckoutKind string
+
+const (
+	CheckoutKindCheckout CheckoutKind = "checkout"
+	CheckoutKindCancel   CheckoutKind = "cancel"
+	CheckoutKindExpired  CheckoutKind = "expired"
+	// CheckoutKindDeclined means that reservation was released because payment was declined.
+	CheckoutKindDeclined CheckoutKind = "declined"
 )
 
 type Checkout struct {
 	Base
-	UserID int
-	ItemID int
-	Code   string
-	Error  string
+	Kind     CheckoutKind
+	UserID   int
+	ItemID   int // 0 for failed checkouts of any item of the sale
+	SaleID   int // set only for checkouts of any item of the sale
+	Quantity int // 1 if not set
+	Code     string
+	Error    string
 }
 
+// CheckoutCode is issued to user on checkout and is used to purchase, cancel or extend the reservation.
+// It's turned into a string and back by CodeSigner, which makes sure users can't forge the codes.
 type CheckoutCode struct {
-	UserID int
-	ItemID int
-	Rand   string
-}
-
-func (c *CheckoutCode) GenerateRand() {
-	c.Rand = randAlphaNum(CheckoutCodeLen)
+	UserID  int
+	ItemID  int
+	Rand    string
+	Expires time.Time // zero for legacy codes
 }
 
-func (c *CheckoutCode) String() string {
-	return strconv.Itoa(c.UserID) + ":" + strconv.Itoa(c.ItemID) + ":" + c.Rand
-}
+var ErrInvalidCode = errors.New("invalid checkout code")
 
-func (c *CheckoutCode) FromString(s string) error {
-	split := strings.Split(s, ":")
-	if len(split) != 3 {
-		return fmt.Errorf("expected code to have 3 parts, got %d", len(split))
+// GenerateRand generates the nonce using g or DefaultCodeGenerator if g is nil.
+func (c *CheckoutCode) GenerateRand(g CodeGenerator) {
+	if g == nil {
+		g = DefaultCodeGenerator
 	}
 
-	userID, err := strconv.Atoi(split[0])
-	if err != nil {
-		return fmt.Errorf("can't parse user_id: %w", err)
-	}
-
-	itemID, err := strconv.Atoi(split[1])
-	if err != nil {
-		return fmt.Errorf("can't parse item_id: %w", err)
-	}
-
-	c.UserID = userID
-	c.ItemID = itemID
-	c.Rand = split[2]
-
-	return nil
+	c.Rand = g.Generate()
 }
 
-func randAlphaNum(n int) string {
-	const alphaNum = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890"
-
-	b := make([]byte, n)
-	for i := range b {
-		b[i] = alphaNum[rand.Intn(len(alphaNum))] // nolint:gosec
-	}
-
-	return string(b)
+// Expired reports whether the code can't be used anymore. Legacy codes carry no expiration,
+// so only the database can tell whether they have expired.
+func (c *CheckoutCode) Expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !now.Before(c.Expires)
 }
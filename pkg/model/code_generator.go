@@ -0,0 +1,153 @@
+package model
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultCodeLen      = 16
+	DefaultCodeAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890"
+
+	// codeReservedChars are used as separators in codes and cache values, so they can't be a part of the nonce.
+	codeReservedChars = ":.|"
+)
+
+// CodeGenerator generates the random part (nonce) of checkout codes.
+// Nonce is the only thing that stops another user from buying the item someone else reserved,
+// so it must not be predictable.
+type CodeGenerator interface {
+	Generate() string
+}
+
+// CodeGeneratorFunc allows to use ordinary function as CodeGenerator, e.g. a deterministic one in tests.
+type CodeGeneratorFunc func() string
+
+func (f CodeGeneratorFunc) Generate() string {
+	return f()
+}
+
+// DefaultCodeGenerator is used when no generator is configured.
+var DefaultCodeGenerator CodeGenerator = &RandCodeGenerator{Len: DefaultCodeLen, Alphabet: DefaultCodeAlphabet}
+
+// RandCodeGenerator generates codes of Len symbols of Alphabet using crypto/rand.
+type RandCodeGenerator struct {
+	Len      int
+	Alphabet string
+	// Source of random bytes, crypto/rand is used if not set. Deterministic source is only meant for tests.
+	Source io.Reader
+}
+
+func NewRandCodeGenerator(length int, alphabet string) (*RandCodeGenerator, error) {
+	if length <= 0 {
+		return nil, fmt.Errorf("code length must be positive, got %d", length)
+	}
+
+	if err := validateAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+
+	return &RandCodeGenerator{Len: length, Alphabet: alphabet}, nil
+}
+
+func (g *RandCodeGenerator) Generate() string {
+	var (
+		b = make([]byte, 0, g.Len)
+		n = len(g.Alphabet)
+		// bytes not less than limit are rejected, so that every symbol of alphabet is equally likely
+		limit = 256 - 256%n
+		buf   = make([]byte, g.Len+g.Len/2)
+	)
+
+	for len(b) < g.Len {
+		g.read(buf)
+
+		for _, r := range buf {
+			if int(r) >= limit {
+				continue
+			}
+
+			b = append(b, g.Alphabet[int(r)%n])
+			if len(b) == g.Len {
+				break
+			}
+		}
+	}
+
+	return string(b)
+}
+
+func (g *RandCodeGenerator) read(buf []byte) {
+	if g.Source == nil {
+		rand.Read(buf) // never returns an error
+		return
+	}
+
+	if _, err := io.ReadFull(g.Source, buf); err != nil {
+		panic(fmt.Sprintf("can't read random bytes: %v", err))
+	}
+}
+
+// UniqueCodeGenerator prefixes random codes with current time and a per-process counter,
+// so the codes issued by one instance never collide and the codes issued by different instances
+// may only collide if they are generated at the same millisecond and have the same random part.
+type UniqueCodeGenerator struct {
+	Rand    *RandCodeGenerator
+	counter atomic.Uint32
+}
+
+func (g *UniqueCodeGenerator) Generate() string {
+	var sb strings.Builder
+
+	sb.WriteString(strconv.FormatInt(time.Now().UnixMilli(), 36))
+	sb.WriteString(strconv.FormatUint(uint64(g.counter.Add(1)), 36))
+	sb.WriteString(g.Rand.Generate())
+
+	return sb.String()
+}
+
+// NewCodeGenerator creates a generator by its name: "random" or "unique".
+func NewCodeGenerator(name string, length int, alphabet string) (CodeGenerator, error) {
+	rg, err := NewRandCodeGenerator(length, alphabet)
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "random":
+		return rg, nil
+	case "unique":
+		return &UniqueCodeGenerator{Rand: rg}, nil
+	default:
+		return nil, fmt.Errorf("unknown code generator %q", name)
+	}
+}
+
+func validateAlphabet(alphabet string) error {
+	if len(alphabet) < 2 || len(alphabet) > 256 {
+		return errors.New("alphabet must consist of 2 to 256 symbols")
+	}
+
+	seen := make(map[byte]bool, len(alphabet))
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+
+		if c < '!' || c > '~' || strings.IndexByte(codeReservedChars, c) != -1 {
+			return fmt.Errorf("alphabet must consist of printable ASCII symbols except for %q", codeReservedChars)
+		}
+
+		if seen[c] {
+			return fmt.Errorf("alphabet contains duplicate symbol %q", c)
+		}
+
+		seen[c] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package model_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+)
+
+func TestRandCodeGenerator_Generate(t *testing.T) {
+	tests := []struct {
+		name     string
+		len      int
+		alphabet string
+		source   []byte
+		want     string
+	}{
+		{
+			name:     "symbols are taken by byte modulo alphabet size",
+			len:      4,
+			alphabet: "ab",
+			source:   []byte{0, 1, 2, 3, 4, 5},
+			want:     "abab",
+		},
+		{
+			name:     "bytes beyond the largest multiple of alphabet size are rejected",
+			len:      2,
+			alphabet: "abc",
+			// 255 is the only byte not less than 255 = 256 - 256%3
+			source: []byte{255, 4, 255, 5, 0, 0},
+			want:   "bc",
+		},
+		{
+			name:     "more bytes are read until the code is complete",
+			len:      2,
+			alphabet: "abc",
+			source:   []byte{255, 255, 255, 255, 1, 255, 2, 0, 0},
+			want:     "bc",
+		},
+		{
+			name:     "every byte is accepted if alphabet size divides 256",
+			len:      3,
+			alphabet: "abcd",
+			source:   []byte{255, 254, 253, 0},
+			want:     "dcb",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &model.RandCodeGenerator{Len: tt.len, Alphabet: tt.alphabet, Source: bytes.NewReader(tt.source)}
+
+			if got := g.Generate(); got != tt.want {
+				t.Errorf("Generate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRandCodeGenerator_GenerateCryptoRand(t *testing.T) {
+	g, err := model.NewRandCodeGenerator(model.DefaultCodeLen, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[rune]bool)
+
+	for range 100 {
+		code := g.Generate()
+
+		if len(code) != model.DefaultCodeLen {
+			t.Fatalf("expected code of %d symbols, got %q", model.DefaultCodeLen, code)
+		}
+
+		for _, c := range code {
+			if !strings.ContainsRune("abc", c) {
+				t.Fatalf("code %q contains symbol %q out of alphabet", code, c)
+			}
+
+			seen[c] = true
+		}
+	}
+
+	if len(seen) != 3 {
+		t.Errorf("expected all the symbols of alphabet to be used, got %v", seen)
+	}
+}
+
+func TestNewRandCodeGenerator(t *testing.T) {
+	tests := []struct {
+		name     string
+		len      int
+		alphabet string
+		wantErr  bool
+	}{
+		{name: "default", len: model.DefaultCodeLen, alphabet: model.DefaultCodeAlphabet},
+		{name: "zero length", len: 0, alphabet: model.DefaultCodeAlphabet, wantErr: true},
+		{name: "single symbol", len: 16, alphabet: "a", wantErr: true},
+		{name: "duplicate symbol", len: 16, alphabet: "abca", wantErr: true},
+		{name: "separator", len: 16, alphabet: "ab:", wantErr: true},
+		{name: "dot", len: 16, alphabet: "ab.", wantErr: true},
+		{name: "space", len: 16, alphabet: "ab ", wantErr: true},
+		{name: "non-ASCII", len: 16, alphabet: "abé", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := model.NewRandCodeGenerator(tt.len, tt.alphabet)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewRandCodeGenerator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUniqueCodeGenerator_Generate(t *testing.T) {
+	// a single symbol of two makes random parts collide all the time
+	g, err := model.NewCodeGenerator("unique", 1, "ab")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+
+	for range 1000 {
+		code := g.Generate()
+		if seen[code] {
+			t.Fatalf("code %q generated twice", code)
+		}
+
+		seen[code] = true
+	}
+}
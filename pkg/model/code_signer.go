@@ -0,0 +1,173 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CodeSigner turns checkout codes into the strings issued to users and verifies the ones users send back,
+// so nobody can use the code made up for someone else's reservation.
+type CodeSigner interface {
+	Sign(CheckoutCode) string
+	// Verify parses the code, errors wrapping ErrInvalidCode are returned for the codes which can't be trusted.
+	Verify(string) (CheckoutCode, error)
+}
+
+// CodeKey is a secret used to sign checkout codes. Its ID is put into the code,
+// so the key can be rotated without invalidating the codes issued before.
+type CodeKey struct {
+	ID     string
+	Secret []byte
+}
+
+// ParseCodeKeys parses keys from string in "id1:secret1,id2:secret2" format.
+func ParseCodeKeys(s string) ([]CodeKey, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var keys []CodeKey
+
+	for _, kv := range strings.Split(s, ",") {
+		id, secret, ok := strings.Cut(kv, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("expected key to be in id:secret format, got %q", kv)
+		}
+
+		if strings.Contains(id, ".") {
+			return nil, fmt.Errorf("key id must not contain dots: %q", id)
+		}
+
+		keys = append(keys, CodeKey{ID: id, Secret: []byte(secret)})
+	}
+
+	return keys, nil
+}
+
+const codeVersion = "v1"
+
+// HMACCodeSigner represents codes as signed tokens "v1.<key id>.<payload>.<signature>",
+// which carry user's ID, item's ID, expiration and the nonce (Rand).
+// The first of the keys is used for signing, the rest are only used for verification.
+//
+// Codes issued before signing was introduced are represented as "<user id>:<item id>:<rand>",
+// they are never issued, but may still be accepted.
+type HMACCodeSigner struct {
+	keys         []CodeKey
+	acceptLegacy bool
+}
+
+// NewHMACCodeSigner creates signer with the keys, at least one of them is required. Legacy codes are accepted
+// if acceptLegacy is set.
+func NewHMACCodeSigner(keys []CodeKey, acceptLegacy bool) (*HMACCodeSigner, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one key is required to sign checkout codes")
+	}
+
+	return &HMACCodeSigner{
+		keys:         slices.Clone(keys),
+		acceptLegacy: acceptLegacy,
+	}, nil
+}
+
+func (s *HMACCodeSigner) Sign(c CheckoutCode) string {
+	key := s.keys[0]
+
+	payload := strconv.Itoa(c.UserID) + ":" + strconv.Itoa(c.ItemID) + ":" + strconv.FormatInt(c.Expires.Unix(), 10) + ":" + c.Rand
+	unsigned := codeVersion + "." + key.ID + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signCode(key, unsigned))
+}
+
+func (s *HMACCodeSigner) Verify(code string) (CheckoutCode, error) {
+	if strings.HasPrefix(code, codeVersion+".") {
+		return s.verifySigned(code)
+	}
+
+	if !s.acceptLegacy {
+		return CheckoutCode{}, fmt.Errorf("%w: legacy codes are not accepted", ErrInvalidCode)
+	}
+
+	return parseLegacyCode(code)
+}
+
+func (s *HMACCodeSigner) verifySigned(code string) (CheckoutCode, error) {
+	split := strings.Split(code, ".")
+	if len(split) != 4 {
+		return CheckoutCode{}, fmt.Errorf("%w: expected code to have 4 parts, got %d", ErrInvalidCode, len(split))
+	}
+
+	idx := slices.IndexFunc(s.keys, func(k CodeKey) bool { return k.ID == split[1] })
+	if idx == -1 {
+		return CheckoutCode{}, fmt.Errorf("%w: unknown key %q", ErrInvalidCode, split[1])
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(split[3])
+	if err != nil {
+		return CheckoutCode{}, fmt.Errorf("%w: can't decode signature: %w", ErrInvalidCode, err)
+	}
+
+	unsigned := code[:len(code)-len(split[3])-1]
+	if !hmac.Equal(sig, signCode(s.keys[idx], unsigned)) {
+		return CheckoutCode{}, fmt.Errorf("%w: signature mismatch", ErrInvalidCode)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(split[2])
+	if err != nil {
+		return CheckoutCode{}, fmt.Errorf("%w: can't decode payload: %w", ErrInvalidCode, err)
+	}
+
+	fields := strings.Split(string(payload), ":")
+	if len(fields) != 4 {
+		return CheckoutCode{}, fmt.Errorf("%w: expected payload to have 4 parts, got %d", ErrInvalidCode, len(fields))
+	}
+
+	userID, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return CheckoutCode{}, fmt.Errorf("%w: can't parse user_id: %w", ErrInvalidCode, err)
+	}
+
+	itemID, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return CheckoutCode{}, fmt.Errorf("%w: can't parse item_id: %w", ErrInvalidCode, err)
+	}
+
+	expires, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return CheckoutCode{}, fmt.Errorf("%w: can't parse expiration: %w", ErrInvalidCode, err)
+	}
+
+	return CheckoutCode{UserID: userID, ItemID: itemID, Rand: fields[3], Expires: time.Unix(expires, 0)}, nil
+}
+
+func parseLegacyCode(code string) (CheckoutCode, error) {
+	split := strings.Split(code, ":")
+	if len(split) != 3 {
+		return CheckoutCode{}, fmt.Errorf("%w: expected code to have 3 parts, got %d", ErrInvalidCode, len(split))
+	}
+
+	userID, err := strconv.Atoi(split[0])
+	if err != nil {
+		return CheckoutCode{}, fmt.Errorf("%w: can't parse user_id: %w", ErrInvalidCode, err)
+	}
+
+	itemID, err := strconv.Atoi(split[1])
+	if err != nil {
+		return CheckoutCode{}, fmt.Errorf("%w: can't parse item_id: %w", ErrInvalidCode, err)
+	}
+
+	return CheckoutCode{UserID: userID, ItemID: itemID, Rand: split[2]}, nil
+}
+
+func signCode(key CodeKey, unsigned string) []byte {
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,226 @@
+package model_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+)
+
+var (
+	oldKey = model.CodeKey{ID: "old", Secret: []byte("old-secret")}
+	newKey = model.CodeKey{ID: "new", Secret: []byte("new-secret")}
+)
+
+func TestHMACCodeSigner(t *testing.T) {
+	code := model.CheckoutCode{UserID: 42, ItemID: 7, Rand: "nonce", Expires: time.Unix(1750000000, 0)}
+	legacyCode := model.CheckoutCode{UserID: 42, ItemID: 7, Rand: "nonce"}
+
+	signedOld := newSigner(t, []model.CodeKey{oldKey}, false).Sign(code)
+	signedNew := newSigner(t, []model.CodeKey{newKey}, false).Sign(code)
+
+	tests := []struct {
+		name    string
+		keys    []model.CodeKey
+		legacy  bool
+		code    string
+		want    model.CheckoutCode
+		wantErr bool
+	}{
+		{
+			name: "signed",
+			keys: []model.CodeKey{newKey},
+			code: signedNew,
+			want: code,
+		},
+		{
+			name: "signed with rotated key",
+			keys: []model.CodeKey{newKey, oldKey},
+			code: signedOld,
+			want: code,
+		},
+		{
+			name:    "signed with removed key",
+			keys:    []model.CodeKey{newKey},
+			code:    signedOld,
+			wantErr: true,
+		},
+		{
+			name:    "signed with unknown key of the same ID",
+			keys:    []model.CodeKey{{ID: "new", Secret: []byte("another-secret")}},
+			code:    signedNew,
+			wantErr: true,
+		},
+		{
+			name:    "tampered signature",
+			keys:    []model.CodeKey{newKey},
+			code:    tamper(signedNew, 3),
+			wantErr: true,
+		},
+		{
+			name:    "tampered payload",
+			keys:    []model.CodeKey{newKey},
+			code:    replacePayload(signedNew, "1:7:1750000000:nonce"),
+			wantErr: true,
+		},
+		{
+			name:    "missing signature",
+			keys:    []model.CodeKey{newKey},
+			code:    signedNew[:strings.LastIndex(signedNew, ".")],
+			wantErr: true,
+		},
+		{
+			name:   "legacy accepted",
+			keys:   []model.CodeKey{newKey},
+			legacy: true,
+			code:   "42:7:nonce",
+			want:   legacyCode,
+		},
+		{
+			name:    "legacy rejected",
+			keys:    []model.CodeKey{newKey},
+			code:    "42:7:nonce",
+			wantErr: true,
+		},
+		{
+			name:    "malformed legacy",
+			keys:    []model.CodeKey{newKey},
+			legacy:  true,
+			code:    "42:nonce",
+			wantErr: true,
+		},
+		{
+			name:    "legacy with invalid user",
+			keys:    []model.CodeKey{newKey},
+			legacy:  true,
+			code:    "user:7:nonce",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			keys:    []model.CodeKey{newKey},
+			legacy:  true,
+			code:    "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := newSigner(t, tt.keys, tt.legacy)
+
+			got, err := signer.Verify(tt.code)
+			if tt.wantErr {
+				if !errors.Is(err, model.ErrInvalidCode) {
+					t.Fatalf("Verify() error = %v, want %v", err, model.ErrInvalidCode)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Verify() unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Verify() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHMACCodeSigner_Sign(t *testing.T) {
+	code := model.CheckoutCode{UserID: 42, ItemID: 7, Rand: "nonce", Expires: time.Unix(1750000000, 0)}
+
+	t.Run("signs with the first key", func(t *testing.T) {
+		got := newSigner(t, []model.CodeKey{newKey, oldKey}, false).Sign(code)
+
+		if !strings.HasPrefix(got, "v1.new.") {
+			t.Errorf("Sign() = %q, expected it to be signed with the new key", got)
+		}
+	})
+
+}
+
+func TestNewHMACCodeSigner_RequiresKeys(t *testing.T) {
+	for _, acceptLegacy := range []bool{false, true} {
+		if _, err := model.NewHMACCodeSigner(nil, acceptLegacy); err == nil {
+			t.Errorf("NewHMACCodeSigner(nil, %v) expected error, got nil", acceptLegacy)
+		}
+	}
+}
+
+func TestParseCodeKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    []model.CodeKey
+		wantErr bool
+	}{
+		{name: "empty", s: ""},
+		{name: "single", s: "new:new-secret", want: []model.CodeKey{newKey}},
+		{name: "several", s: "new:new-secret,old:old-secret", want: []model.CodeKey{newKey, oldKey}},
+		{name: "secret with colon", s: "new:a:b", want: []model.CodeKey{{ID: "new", Secret: []byte("a:b")}}},
+		{name: "no secret", s: "new", wantErr: true},
+		{name: "empty secret", s: "new:", wantErr: true},
+		{name: "empty id", s: ":secret", wantErr: true},
+		{name: "id with dot", s: "n.ew:secret", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := model.ParseCodeKeys(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCodeKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseCodeKeys() = %v, want %v", got, tt.want)
+			}
+
+			for i := range got {
+				if got[i].ID != tt.want[i].ID || string(got[i].Secret) != string(tt.want[i].Secret) {
+					t.Errorf("ParseCodeKeys()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func newSigner(t *testing.T, keys []model.CodeKey, acceptLegacy bool) *model.HMACCodeSigner {
+	t.Helper()
+
+	signer, err := model.NewHMACCodeSigner(keys, acceptLegacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer
+}
+
+// tamper changes the symbol of the part of the code, which is "v1.<key id>.<payload>.<signature>".
+func tamper(code string, part int) string {
+	parts := strings.Split(code, ".")
+
+	b := []byte(parts[part])
+	if b[0] == 'A' {
+		b[0] = 'B'
+	} else {
+		b[0] = 'A'
+	}
+
+	parts[part] = string(b)
+
+	return strings.Join(parts, ".")
+}
+
+// replacePayload puts another payload into the code keeping its signature.
+func replacePayload(code, payload string) string {
+	parts := strings.Split(code, ".")
+	parts[2] = base64.RawURLEncoding.EncodeToString([]byte(payload))
+
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor points to the last record of the page for keyset pagination, so the next page starts right after it.
+// Clients get it as an opaque string which is only valid for the same sort order.
+type Cursor struct {
+	Sort  string `json:"s,omitempty"` // sort order the cursor was issued for
+	Value string `json:"v,omitempty"` // value of the sort field of the last record
+	ID    int    `json:"id"`
+}
+
+func (c Cursor) String() string {
+	b, _ := json.Marshal(c) // can't fail on strings and ints
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseCursor parses cursor from its string form. Empty string means the first page, so zero cursor is returned.
+func ParseCursor(s string) (Cursor, error) {
+	var c Cursor
+
+	if s == "" {
+		return c, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+
+	return c, nil
+}
+
+// IsFirst reports whether the cursor points to the beginning of the list.
+func (c Cursor) IsFirst() bool {
+	return c.ID == 0
+}
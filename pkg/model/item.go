@@ -1,23 +1,182 @@
 package model
 
 import (
-	"database/sql"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 )
 
+const (
+	// DefaultCurrency is used for items which don't have currency set.
+	DefaultCurrency = "USD"
+	// MaxCartSize is how many different items may be checked out with a single code.
+	MaxCartSize = 20
+)
+
 var (
-	ErrItemUnavailable = errors.New("item is unavailable for checkout")
+	ErrItemUnavailable   = errors.New("item is unavailable for checkout")
+	ErrInvalidCart       = errors.New("invalid cart")
+	ErrInvalidPrice      = errors.New("price must not be negative nor exceed original price, currency must be ISO 4217 code")
+	ErrInvalidItemFilter = errors.New("sale_id must not be negative, items can be sorted by " + strings.Join(ItemSortFields, ", ") + " only")
 )
 
+// ItemSortFields are the fields which items can be sorted by.
+var ItemSortFields = []string{"id", "name", "price", "discount_percent", "created_at"}
+
+// Item is a product put on sale with a stock of Quantity units.
+// Units are reserved and sold independently, see Reservation.
 type Item struct {
 	Base
-	Name          string         `json:"name"`
-	SaleID        int            `json:"sale_id"`
-	SaleStart     time.Time      `json:"-"`
-	SaleEnd       time.Time      `json:"-"`
-	Sold          bool           `json:"sold"`
-	ReservedUntil sql.NullTime   `json:"-"`
-	ReservedBy    sql.NullInt64  `json:"-"`
-	Code          sql.NullString `json:"-"`
+	Name              string    `json:"name"`
+	SaleID            int       `json:"sale_id"`
+	SaleStart         time.Time `json:"-"`
+	SaleEnd           time.Time `json:"-"`
+	Sold              bool      `json:"sold"` // whole stock is sold out
+	Quantity          int       `json:"quantity"`
+	AvailableQuantity int       `json:"available_quantity"` // neither reserved nor sold
+	ReservedQuantity  int       `json:"reserved_quantity"`
+	SoldQuantity      int       `json:"sold_quantity"`
+	// Availability is derived from the quantities, see SetAvailability.
+	Availability ItemAvailability `json:"availability"`
+	// Prices are in minor units (e.g. cents) of the currency.
+	Price         int64  `json:"price"`
+	OriginalPrice int64  `json:"original_price"` // price before the sale
+	Currency      string `json:"currency"`
+	// DiscountPercent is how much less the item costs within the sale in percents of its original price.
+	DiscountPercent int `json:"discount_percent"`
+}
+
+// ItemAvailability tells whether units of the item can be checked out.
+type ItemAvailability string
+
+const (
+	ItemAvailable ItemAvailability = "available"
+	// ItemReserved means that there are no units available at the moment,
+	// but some of them are reserved and may be back if the reservation is cancelled or expires.
+	ItemReserved ItemAvailability = "reserved"
+	ItemSold     ItemAvailability = "sold"
+)
+
+// SetAvailability derives reserved quantity and availability from the other quantities.
+// Units taken from stock are either reserved or sold, while the written off ones leave the stock.
+func (i *Item) SetAvailability() {
+	i.ReservedQuantity = max(i.Quantity-i.AvailableQuantity-i.SoldQuantity, 0)
+
+	switch {
+	case i.AvailableQuantity > 0:
+		i.Availability = ItemAvailable
+	case i.ReservedQuantity > 0:
+		i.Availability = ItemReserved
+	default:
+		i.Availability = ItemSold
+	}
+}
+
+// ValidPrice checks that item is not sold at negative price nor above its original price.
+func (i Item) ValidPrice() bool {
+	if i.Price < 0 || i.Price > i.OriginalPrice || len(i.Currency) != 3 {
+		return false
+	}
+
+	for _, r := range i.Currency {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CartItem is a number of units of the item which are checked out, purchased or cancelled together.
+type CartItem struct {
+	ItemID   int `json:"item_id"`
+	Quantity int `json:"quantity"`
+}
+
+// NewCart merges units of the same item, so the cart is sorted by item's ID and has no duplicates.
+// Errors wrap ErrInvalidCart.
+func NewCart(items []CartItem) ([]CartItem, error) {
+	quantities := make(map[int]int, len(items))
+	for _, item := range items {
+		if item.ItemID <= 0 {
+			return nil, fmt.Errorf("%w: invalid item_id: %d", ErrInvalidCart, item.ItemID)
+		}
+
+		if item.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: invalid quantity of item %d: %d", ErrInvalidCart, item.ItemID, item.Quantity)
+		}
+
+		quantities[item.ItemID] += item.Quantity
+	}
+
+	if len(quantities) == 0 || len(quantities) > MaxCartSize {
+		return nil, fmt.Errorf("%w: cart must contain from 1 to %d items", ErrInvalidCart, MaxCartSize)
+	}
+
+	cart := make([]CartItem, 0, len(quantities))
+	for itemID, quantity := range quantities {
+		cart = append(cart, CartItem{ItemID: itemID, Quantity: quantity})
+	}
+
+	slices.SortFunc(cart, func(a, b CartItem) int { return a.ItemID - b.ItemID })
+
+	return cart, nil
+}
+
+// ItemFilter narrows down the list of items. Zero value matches all the items sorted by ID.
+type ItemFilter struct {
+	SaleID int   // 0 for any sale
+	Sold   *bool // whether the whole stock is sold out, nil for both
+	// AvailableNow leaves only the items which can be checked out at the moment:
+	// their sale is running and is not paused, and they have units available.
+	AvailableNow bool
+	Search       string // case-insensitive substring of the name
+	// Sort is one of ItemSortFields, prefixed with "-" for descending order.
+	Sort string
+}
+
+// SortField returns the field to sort items by and whether the order is descending.
+func (f ItemFilter) SortField() (field string, desc bool) {
+	if f.Sort == "" {
+		return "id", false
+	}
+
+	field, desc = strings.CutPrefix(f.Sort, "-")
+
+	return field, desc
+}
+
+func (f ItemFilter) Valid() bool {
+	field, _ := f.SortField()
+	return f.SaleID >= 0 && slices.Contains(ItemSortFields, field)
+}
+
+// ReservationStatus tells what happened to the reservation.
+type ReservationStatus string
+
+const (
+	ReservationStatusActive    ReservationStatus = "active"
+	ReservationStatusPurchased ReservationStatus = "purchased"
+	ReservationStatusCancelled ReservationStatus = "cancelled"
+	ReservationStatusExpired   ReservationStatus = "expired"
+	// ReservationStatusPaying means that reservation is on hold while it's being paid for.
+	ReservationStatusPaying ReservationStatus = "paying"
+	// ReservationStatusPaymentUnknown means that money may have been moved for the reservation, but it hasn't been
+	// purchased. Its units are kept out of stock until it's reconciled with payment provider.
+	ReservationStatusPaymentUnknown ReservationStatus = "payment_unknown"
+)
+
+// Reservation holds Quantity units of the item for the user until ReservedUntil.
+// All the reservations made with the same code (e.g. cart) are purchased, cancelled and extended all together.
+type Reservation struct {
+	Base
+	ItemID        int               `json:"item_id"`
+	UserID        int               `json:"user_id"`
+	Quantity      int               `json:"quantity"`
+	Code          CheckoutCode      `json:"-"` // gives access to the reservation, so it must never be shown
+	ReservedUntil time.Time         `json:"reserved_until"`
+	Extensions    int               `json:"extensions"`
+	Status        ReservationStatus `json:"status"`
 }
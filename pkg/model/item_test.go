@@ -0,0 +1,84 @@
+package model_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+)
+
+func TestNewCart(t *testing.T) {
+	tooMany := make([]model.CartItem, 0, model.MaxCartSize+1)
+	for i := range model.MaxCartSize + 1 {
+		tooMany = append(tooMany, model.CartItem{ItemID: i + 1, Quantity: 1})
+	}
+
+	tests := []struct {
+		name    string
+		items   []model.CartItem
+		want    []model.CartItem
+		wantErr bool
+	}{
+		{
+			name:  "sorted by item",
+			items: []model.CartItem{{ItemID: 3, Quantity: 1}, {ItemID: 1, Quantity: 2}},
+			want:  []model.CartItem{{ItemID: 1, Quantity: 2}, {ItemID: 3, Quantity: 1}},
+		},
+		{
+			name:  "units of the same item merged",
+			items: []model.CartItem{{ItemID: 2, Quantity: 1}, {ItemID: 1, Quantity: 1}, {ItemID: 2, Quantity: 3}},
+			want:  []model.CartItem{{ItemID: 1, Quantity: 1}, {ItemID: 2, Quantity: 4}},
+		},
+		{
+			name:    "empty",
+			wantErr: true,
+		},
+		{
+			name:    "too many items",
+			items:   tooMany,
+			wantErr: true,
+		},
+		{
+			name:    "zero item_id",
+			items:   []model.CartItem{{ItemID: 0, Quantity: 1}},
+			wantErr: true,
+		},
+		{
+			name:    "negative item_id",
+			items:   []model.CartItem{{ItemID: -1, Quantity: 1}},
+			wantErr: true,
+		},
+		{
+			name:    "zero quantity",
+			items:   []model.CartItem{{ItemID: 1, Quantity: 0}},
+			wantErr: true,
+		},
+		{
+			name:    "negative quantity",
+			items:   []model.CartItem{{ItemID: 1, Quantity: 2}, {ItemID: 1, Quantity: -1}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := model.NewCart(tt.items)
+			if tt.wantErr {
+				if !errors.Is(err, model.ErrInvalidCart) {
+					t.Fatalf("NewCart() error = %v, want %v", err, model.ErrInvalidCart)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("NewCart() unexpected error: %v", err)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("NewCart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package model
+
+// Order is a record of purchase of the reserved units of the item.
+// Prices are copied from the item at the moment of purchase.
+type Order struct {
+	Base
+	UserID        int    `json:"user_id"`
+	ItemID        int    `json:"item_id"`
+	SaleID        int    `json:"sale_id"`
+	ReservationID int    `json:"-"`
+	Quantity      int    `json:"quantity"`
+	Price         int64  `json:"price"` // price of a unit in minor units of the currency
+	OriginalPrice int64  `json:"original_price"`
+	Currency      string `json:"currency"`
+	PaymentID     string `json:"-"` // empty if purchase was made without payment step
+	// RefundedQuantity is how many of the units have been returned.
+	RefundedQuantity int `json:"refunded_quantity"`
+}
+
+// Total returns the price of all the units of the order.
+func (o Order) Total() int64 {
+	return o.Price * int64(o.Quantity)
+}
@@ -0,0 +1,40 @@
+package model
+
+import "errors"
+
+var ErrInvalidRefund = errors.New("refund quantity must be positive and not exceed units of the order which are not refunded yet")
+
+// RefundRequest tells which part of the order is refunded and what to do with the units.
+type RefundRequest struct {
+	Quantity int `json:"quantity"` // all the units which are not refunded yet if not set
+	// Restock puts the units back on sale if the sale is still running. Otherwise the units are written off.
+	Restock bool   `json:"restock"`
+	Reason  string `json:"reason"`
+}
+
+// RefundStatus tells whether the money of the refund has been returned.
+type RefundStatus string
+
+const (
+	// RefundStatusPending means that refund is being made or its outcome is unknown. Its units can't be refunded
+	// again, but are not returned to stock until it's completed.
+	RefundStatusPending   RefundStatus = "pending"
+	RefundStatusCompleted RefundStatus = "completed"
+	// RefundStatusFailed means that payment provider has refused to return the money, so nothing is refunded.
+	RefundStatusFailed RefundStatus = "failed"
+)
+
+// Refund is an audit record of returned units of the order.
+type Refund struct {
+	Base
+	OrderID   int          `json:"order_id"`
+	UserID    int          `json:"user_id"`
+	ItemID    int          `json:"item_id"`
+	SaleID    int          `json:"sale_id"`
+	Quantity  int          `json:"quantity"`
+	Amount    int64        `json:"amount"` // in minor units of the currency
+	Currency  string       `json:"currency"`
+	Restocked bool         `json:"restocked"`
+	Reason    string       `json:"reason"`
+	Status    RefundStatus `json:"status"`
+}
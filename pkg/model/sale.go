@@ -1,16 +1,50 @@
 package model
 
 import (
+	"errors"
 	"time"
 )
 
 const (
-	SaleDuration = time.Hour
-	ItemsPerSale = 10000
+	DefaultSaleDuration   = time.Hour
+	DefaultPurchasesLimit = 10
+	ItemsPerSale          = 10000
+)
+
+var (
+	ErrInvalidSaleWindow   = errors.New("sale must end after it starts")
+	ErrInvalidSaleSettings = errors.New("purchases limit and checkout timeout must be positive")
 )
 
 type Sale struct {
 	Base
 	StartAt time.Time `json:"start_at"`
 	EndAt   time.Time `json:"end_at"`
+	Paused  bool      `json:"paused"` // items of paused sale can't be checked out or purchased
+
+	PurchasesLimit  int      `json:"purchases_limit"` // number of items single user can buy within the sale
+	CheckoutTimeout Duration `json:"checkout_timeout"`
+	ItemsCount      int      `json:"items_count"`
+}
+
+// Active reports whether items of the sale can be checked out at the moment.
+func (s Sale) Active(now time.Time) bool {
+	return !s.Paused && !now.Before(s.StartAt) && now.Before(s.EndAt)
+}
+
+// SaleStats are live counts of units of the sale's items.
+type SaleStats struct {
+	Available int `json:"available"`
+	Reserved  int `json:"reserved"`
+	Sold      int `json:"sold"`
+}
+
+// SaleSettings are the rules of the sale which may be changed while it's running.
+type SaleSettings struct {
+	PurchasesLimit  int      `json:"purchases_limit"`
+	CheckoutTimeout Duration `json:"checkout_timeout"`
+}
+
+func (s SaleSettings) Valid() bool {
+	return s.PurchasesLimit > 0 && s.CheckoutTimeout > 0
 }
@@ -0,0 +1,98 @@
+package payment
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+)
+
+// Outcome tells how Fake responds to authorizations, captures and refunds.
+type Outcome string
+
+const (
+	OutcomeSucceed Outcome = "succeed"
+	OutcomeDecline Outcome = "decline"
+	// OutcomeTimeout makes Fake hang until context is done.
+	OutcomeTimeout Outcome = "timeout"
+)
+
+func (o Outcome) validate() error {
+	switch o {
+	case OutcomeSucceed, OutcomeDecline, OutcomeTimeout:
+		return nil
+	default:
+		return fmt.Errorf("unknown fake payment outcome %q", o)
+	}
+}
+
+// Fake is an in-process Provider which doesn't move any money.
+// It keeps no state, so payments made by other instances or before restart can be refunded as well:
+// any ID with "fake_" prefix is taken as the one it has issued. Its responses depend on Outcome only,
+// so it can be used to reproduce any of them end to end.
+type Fake struct {
+	Outcome Outcome
+}
+
+const fakeIDPrefix = "fake_"
+
+func NewFake(outcome Outcome) *Fake {
+	return &Fake{Outcome: outcome}
+}
+
+func (f *Fake) Authorize(ctx context.Context, p Payment) (string, error) {
+	if err := f.respond(ctx); err != nil {
+		return "", err
+	}
+
+	if p.Amount < 0 {
+		return "", fmt.Errorf("%w: negative amount", ErrDeclined)
+	}
+
+	return fakeIDPrefix + rand.Text(), nil
+}
+
+func (f *Fake) Capture(ctx context.Context, authID string) error {
+	if err := validateFakeID(authID); err != nil {
+		return err
+	}
+
+	return f.respond(ctx)
+}
+
+func (f *Fake) Void(ctx context.Context, authID string) error {
+	return validateFakeID(authID)
+}
+
+func (f *Fake) Refund(ctx context.Context, paymentID string, amount int64, reference string) error {
+	if err := validateFakeID(paymentID); err != nil {
+		return err
+	}
+
+	if amount < 0 {
+		return fmt.Errorf("can't refund negative amount of payment %q", paymentID)
+	}
+
+	return f.respond(ctx)
+}
+
+// respond responds according to Outcome.
+func (f *Fake) respond(ctx context.Context) error {
+	switch f.Outcome {
+	case OutcomeDecline:
+		return ErrDeclined
+	case OutcomeTimeout:
+		<-ctx.Done()
+		return fmt.Errorf("%w: %w", ErrTimeout, ctx.Err())
+	default:
+		return nil
+	}
+}
+
+func validateFakeID(id string) error {
+	if !strings.HasPrefix(id, fakeIDPrefix) {
+		return fmt.Errorf("payment %q is not made by fake provider", id)
+	}
+
+	return nil
+}
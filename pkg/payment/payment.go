@@ -0,0 +1,50 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrDeclined = errors.New("payment declined")
+	// ErrTimeout means that provider hasn't responded in time, so the outcome of the payment is unknown.
+	ErrTimeout = errors.New("payment timed out")
+)
+
+// Payment is a request to charge user.
+type Payment struct {
+	UserID   int
+	Amount   int64 // in minor units of the currency
+	Currency string
+	// Reference identifies the payment on our side, so provider can tell a retry from a new payment.
+	Reference string
+}
+
+// Provider moves money in two steps: Authorize holds the amount on user's account
+// and Capture actually charges it. Authorization which is not going to be captured must be voided.
+type Provider interface {
+	// Authorize returns ID of the authorization which is passed to Capture and Void.
+	Authorize(ctx context.Context, p Payment) (string, error)
+	Capture(ctx context.Context, authID string) error
+	Void(ctx context.Context, authID string) error
+	// Refund returns amount of the captured payment to user. Payment may be refunded in several parts.
+	// Reference identifies the refund on our side, so provider can tell a retry from a new refund.
+	Refund(ctx context.Context, paymentID string, amount int64, reference string) error
+}
+
+// New creates provider by its name. Only "fake" provider is available at the moment,
+// fakeOutcome configures how it responds.
+func New(name string, fakeOutcome string) (Provider, error) {
+	switch name {
+	case "fake":
+		outcome := Outcome(fakeOutcome)
+		if err := outcome.validate(); err != nil {
+			return nil, err
+		}
+
+		return NewFake(outcome), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", name)
+	}
+}
@@ -0,0 +1,159 @@
+// Package apierror maps errors to HTTP responses of the same shape:
+//
+//	{"error": {"code": "ITEM_UNAVAILABLE", "message": "...", "retry_after": 10}}
+//
+// Clients are expected to rely on the code, while the message is only meant to be read by humans.
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/database"
+	"github.com/IlyushaZ/not-back-contest/pkg/idempotency"
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+	"github.com/IlyushaZ/not-back-contest/pkg/payment"
+	"github.com/IlyushaZ/not-back-contest/pkg/service"
+)
+
+// Code tells what went wrong, the list of them is a part of API.
+type Code string
+
+const (
+	CodeBadRequest           Code = "BAD_REQUEST"
+	CodeInvalidCode          Code = "INVALID_CODE"
+	CodeInvalidCursor        Code = "INVALID_CURSOR"
+	CodeInvalidFilter        Code = "INVALID_FILTER"
+	CodeInvalidSale          Code = "INVALID_SALE"
+	CodeInvalidRefund        Code = "INVALID_REFUND"
+	CodeUnauthorized         Code = "UNAUTHORIZED"
+	CodeNotFound             Code = "NOT_FOUND"
+	CodeMethodNotAllowed     Code = "METHOD_NOT_ALLOWED"
+	CodeItemUnavailable      Code = "ITEM_UNAVAILABLE"
+	CodeExtensionsExceeded   Code = "EXTENSIONS_EXCEEDED"
+	CodeReferenced           Code = "REFERENCED"
+	CodeIdempotencyKeyInUse  Code = "IDEMPOTENCY_KEY_IN_USE"
+	CodeIdempotencyKeyReused Code = "IDEMPOTENCY_KEY_REUSED"
+	CodeLimitExceeded        Code = "LIMIT_EXCEEDED"
+	CodePaymentDeclined      Code = "PAYMENT_DECLINED"
+	CodePaymentTimeout       Code = "PAYMENT_TIMEOUT"
+	CodeTimeout              Code = "TIMEOUT"
+	CodeInternal             Code = "INTERNAL"
+)
+
+// Error is an error which is shown to the client as is.
+type Error struct {
+	Status  int    `json:"-"`
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+	// RetryAfter is the number of seconds after which the request may succeed, zero if it's unknown.
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+type response struct {
+	Error *Error `json:"error"`
+}
+
+func New(status int, code Code, format string, args ...any) *Error {
+	return &Error{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// BadRequest is an error of request's params or body.
+func BadRequest(format string, args ...any) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, format, args...)
+}
+
+func MethodNotAllowed(method string) *Error {
+	return New(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "only %s method allowed", method)
+}
+
+// mapping lists errors of the services along with the responses they're reported with, in order of precedence.
+// If message is empty, the error's text is shown, so it must not be set for the errors carrying internal details.
+var mapping = []struct {
+	err     error
+	status  int
+	code    Code
+	message string
+}{
+	{model.ErrInvalidCart, http.StatusBadRequest, CodeBadRequest, ""},
+	{model.ErrInvalidCode, http.StatusBadRequest, CodeInvalidCode, ""},
+	{model.ErrInvalidCursor, http.StatusBadRequest, CodeInvalidCursor, ""},
+	{model.ErrInvalidItemFilter, http.StatusBadRequest, CodeInvalidFilter, model.ErrInvalidItemFilter.Error()},
+	{model.ErrInvalidSaleWindow, http.StatusBadRequest, CodeInvalidSale, model.ErrInvalidSaleWindow.Error()},
+	{model.ErrInvalidSaleSettings, http.StatusBadRequest, CodeInvalidSale, model.ErrInvalidSaleSettings.Error()},
+	{model.ErrInvalidPrice, http.StatusBadRequest, CodeInvalidSale, model.ErrInvalidPrice.Error()},
+	{model.ErrInvalidRefund, http.StatusConflict, CodeInvalidRefund, model.ErrInvalidRefund.Error()},
+	{database.ErrNotFound, http.StatusNotFound, CodeNotFound, "not found"},
+	{database.ErrReferenced, http.StatusConflict, CodeReferenced, "record is referenced by other records, e.g. sale has orders"},
+	{model.ErrItemUnavailable, http.StatusConflict, CodeItemUnavailable, "item is unavailable for checkout: either there are not enough units left or the sale is not active"},
+	{model.ErrExtensionsExceeded, http.StatusConflict, CodeExtensionsExceeded, model.ErrExtensionsExceeded.Error()},
+	{idempotency.ErrInProgress, http.StatusConflict, CodeIdempotencyKeyInUse, idempotency.ErrInProgress.Error()},
+	{idempotency.ErrMismatch, http.StatusUnprocessableEntity, CodeIdempotencyKeyReused, idempotency.ErrMismatch.Error()},
+	{service.ErrLimitExceeded, http.StatusTooManyRequests, CodeLimitExceeded, "purchases limit of the sale exceeded"},
+	{payment.ErrDeclined, http.StatusPaymentRequired, CodePaymentDeclined, "payment declined"},
+	{payment.ErrTimeout, http.StatusGatewayTimeout, CodePaymentTimeout, "payment provider hasn't responded in time"},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, CodeTimeout, "request timed out"},
+}
+
+// From returns the response which err is reported with. Errors which are not known are reported as internal ones
+// without any details, so the caller must log them.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	for _, m := range mapping {
+		if !errors.Is(err, m.err) {
+			continue
+		}
+
+		e = &Error{Status: m.status, Code: m.code, Message: m.message}
+		if e.Message == "" {
+			e.Message = err.Error()
+		}
+
+		var le *service.LimitError
+		if errors.As(err, &le) && le.RetryAfter > 0 {
+			e.RetryAfter = int(math.Ceil(le.RetryAfter.Seconds()))
+		}
+
+		return e
+	}
+
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal error"}
+}
+
+// Write writes the response for err. Unknown errors are logged along with the request they occurred on,
+// while *Error is expected to be logged by its creator, if needed.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	e := From(err)
+
+	if e.Status == http.StatusInternalServerError && !errors.As(err, new(*Error)) {
+		slog.Error("request failed",
+			slog.String("method", r.Method),
+			slog.String("request_uri", r.URL.RequestURI()),
+			slog.Any("error", err),
+		)
+	}
+
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(e.RetryAfter))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+
+	json.NewEncoder(w).Encode(response{e}) // nothing can be done if it fails, as the status is already sent
+}
@@ -1,6 +1,195 @@
 package handler
 
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+	"github.com/IlyushaZ/not-back-contest/pkg/server/apierror"
+	"github.com/IlyushaZ/not-back-contest/pkg/service"
+)
+
+// ListPageResp is a page of either page_num or cursor pagination. Exact total is counted for the former only,
+// the latter may have an estimate of it instead.
 type ListPageResp[T any] struct {
-	Page  []T `json:"page"`
-	Total int `json:"total"`
+	Page          []T    `json:"page"`
+	Total         *int   `json:"total,omitempty"`
+	NextCursor    string `json:"next_cursor,omitempty"` // empty on the last page
+	TotalEstimate *int   `json:"total_estimate,omitempty"`
+}
+
+type CheckoutCartReq struct {
+	UserID  int              `json:"user_id"`
+	ItemIDs []int            `json:"item_ids"`
+	Items   []model.CartItem `json:"items"`
+}
+
+type CheckoutAnyResp struct {
+	Code   string `json:"code"`
+	ItemID int    `json:"item_id"`
+}
+
+// PurchaseResp lists the orders created on purchase, ItemIDs are kept for the clients which rely on them.
+type PurchaseResp struct {
+	ItemIDs []int         `json:"item_ids"`
+	Orders  []model.Order `json:"orders"`
+}
+
+type ExtendResp struct {
+	Code          string    `json:"code"`
+	ReservedUntil time.Time `json:"reserved_until"`
+}
+
+// WSReq is a command sent over WebSocket. ID is an arbitrary string echoed back in the response to the command.
+// Type is one of "checkout", "purchase", "cancel" or "extend". Checkout takes either ItemID with Quantity
+// or ItemIDs and Items of the cart, the rest of the commands take Code.
+type WSReq struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	ItemID   int              `json:"item_id"`
+	Quantity int              `json:"quantity"`
+	ItemIDs  []int            `json:"item_ids"`
+	Items    []model.CartItem `json:"items"`
+	Code     string           `json:"code"`
+}
+
+// WSResp is either a response to the command with its ID and Type or a message pushed by server:
+// "expiring" when reservation is about to expire or "expired" when it has.
+// Status and Error are the same as HTTP API would respond with.
+type WSResp struct {
+	ID            string           `json:"id,omitempty"`
+	Type          string           `json:"type"`
+	Status        int              `json:"status"`
+	Error         *apierror.Error  `json:"error,omitempty"`
+	Code          string           `json:"code,omitempty"`
+	ReservedUntil *time.Time       `json:"reserved_until,omitempty"`
+	ExpiresIn     *int             `json:"expires_in,omitempty"` // seconds
+	Items         []model.CartItem `json:"items,omitempty"`
+	Orders        []model.Order    `json:"orders,omitempty"`
+}
+
+// SaleStatusResp lets clients know which sales are running or coming without relying on their own clock.
+type SaleStatusResp struct {
+	ServerTime time.Time    `json:"server_time"`
+	Sales      []SaleStatus `json:"sales"`
+}
+
+type SaleStatus struct {
+	model.Sale
+	StartsIn int             `json:"starts_in"` // seconds until the start, 0 if the sale has started
+	EndsIn   int             `json:"ends_in"`   // seconds until the end
+	Stats    model.SaleStats `json:"stats"`
+}
+
+type SaleCreateReq struct {
+	StartAt time.Time `json:"start_at"`
+	EndAt   time.Time `json:"end_at"`
+	model.SaleSettings
+	Items []struct {
+		Name          string `json:"name"`
+		Quantity      int    `json:"quantity"` // 1 if not set
+		Price         int64  `json:"price"`
+		OriginalPrice int64  `json:"original_price"` // equals to price if not set
+		Currency      string `json:"currency"`       // model.DefaultCurrency if not set
+	} `json:"items"`
+}
+
+type SaleCreateResp struct {
+	model.Sale
+	ItemIDs []int `json:"item_ids"`
+}
+
+type SaleWindowReq struct {
+	StartAt time.Time `json:"start_at"`
+	EndAt   time.Time `json:"end_at"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		// the status is already sent, so the error can't be reported to the client
+		slog.Error("can't encode response", slog.Any("error", err))
+	}
+}
+
+// writeError writes error response in the format shared by all the handlers, see apierror.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apierror.Write(w, r, err)
+}
+
+// pathID parses "id" path value. If false is returned, the response has already been written.
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeError(w, r, apierror.BadRequest("invalid id: %q", r.PathValue("id")))
+		return 0, false
+	}
+
+	return id, true
+}
+
+// parsePage parses page_num and page_size query params, defaults are used for the missing ones.
+// If false is returned, the response has already been written.
+func parsePage(w http.ResponseWriter, r *http.Request) (pageNum, pageSize int, ok bool) {
+	var (
+		q   = r.URL.Query()
+		err error
+	)
+
+	pageNum, pageSize = service.DefaultPageNum, service.DefaultPageSize
+
+	if pn := q.Get("page_num"); pn != "" {
+		pageNum, err = strconv.Atoi(pn)
+		if err != nil {
+			writeError(w, r, apierror.BadRequest("can't parse page_num: %v", err))
+			return 0, 0, false
+		}
+	}
+
+	if ps := q.Get("page_size"); ps != "" {
+		pageSize, err = strconv.Atoi(ps)
+		if err != nil {
+			writeError(w, r, apierror.BadRequest("can't parse page_size: %v", err))
+			return 0, 0, false
+		}
+	}
+
+	if pageNum <= 0 || pageSize <= 0 {
+		writeError(w, r, apierror.BadRequest("page_num and page_size must be positive"))
+		return 0, 0, false
+	}
+
+	return pageNum, pageSize, true
+}
+
+// parseCursor parses cursor query param. Empty cursor starts cursor pagination from the beginning,
+// while if the param is not set at all, keyset is false and page_num pagination is used.
+// If estimate_total param is set, the total has to be estimated.
+// If ok is false, the response has already been written.
+func parseCursor(w http.ResponseWriter, r *http.Request) (cursor model.Cursor, keyset, estimate, ok bool) {
+	q := r.URL.Query()
+	if !q.Has("cursor") {
+		return cursor, false, false, true
+	}
+
+	cursor, err := model.ParseCursor(q.Get("cursor"))
+	if err != nil {
+		writeError(w, r, err)
+		return cursor, false, false, false
+	}
+
+	if v := q.Get("estimate_total"); v != "" {
+		estimate, err = strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, apierror.BadRequest("can't parse estimate_total: %v", err))
+			return cursor, false, false, false
+		}
+	}
+
+	return cursor, true, estimate, true
 }
@@ -3,21 +3,27 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/IlyushaZ/not-back-contest/pkg/database"
 	"github.com/IlyushaZ/not-back-contest/pkg/model"
+	"github.com/IlyushaZ/not-back-contest/pkg/server/apierror"
 	"github.com/IlyushaZ/not-back-contest/pkg/service"
 )
 
 func ItemCheckout(svc service.Item) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "only POST method allowed", http.StatusMethodNotAllowed)
+			writeError(w, r, apierror.MethodNotAllowed(http.MethodPost))
+			return
+		}
+
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			checkoutCart(svc, w, r)
 			return
 		}
 
@@ -25,127 +31,385 @@ func ItemCheckout(svc service.Item) http.HandlerFunc {
 
 		userID, err := strconv.Atoi(q.Get("user_id"))
 		if err != nil {
-			http.Error(w, fmt.Sprintf("can't parse user_id: %v", err), http.StatusBadRequest)
+			writeError(w, r, apierror.BadRequest("can't parse user_id: %v", err))
 			return
 		}
 
 		itemID, err := strconv.Atoi(q.Get("item_id"))
 		if err != nil {
-			http.Error(w, fmt.Sprintf("can't parse item_id: %v", err), http.StatusBadRequest)
+			writeError(w, r, apierror.BadRequest("can't parse item_id: %v", err))
 			return
 		}
 
 		if userID == 0 {
-			http.Error(w, fmt.Sprintf("invalid user_id: %d", 0), http.StatusBadRequest)
+			writeError(w, r, apierror.BadRequest("invalid user_id: %d", 0))
 			return
 		}
 
 		if itemID == 0 {
-			http.Error(w, fmt.Sprintf("invalid item_id: %d", 0), http.StatusBadRequest)
+			writeError(w, r, apierror.BadRequest("invalid item_id: %d", 0))
 			return
 		}
 
+		quantity := 1
+		if qs := q.Get("quantity"); qs != "" {
+			quantity, err = strconv.Atoi(qs)
+			if err != nil {
+				writeError(w, r, apierror.BadRequest("can't parse quantity: %v", err))
+				return
+			}
+
+			if quantity <= 0 {
+				writeError(w, r, apierror.BadRequest("invalid quantity: %d", quantity))
+				return
+			}
+		}
+
 		ctx, cancel := context.WithTimeout(r.Context(), time.Second)
 		defer cancel()
 
-		code, err := svc.Checkout(ctx, userID, itemID)
-		switch {
-		case errors.Is(err, model.ErrItemUnavailable):
-			msg := fmt.Sprintf("%s: either because it's already checked out or because the sale is not active", err.Error())
-			http.Error(w, msg, http.StatusConflict)
-			return
-		case errors.Is(err, service.ErrLimitExceeded):
-			http.Error(w, err.Error(), http.StatusTooManyRequests)
-			return
-		case err != nil:
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		code, err := svc.Checkout(ctx, userID, itemID, quantity)
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		resp := []byte(fmt.Sprintf(`{"code":"%s"}`, code))
 		if _, err := w.Write(resp); err != nil {
-			http.Error(w, fmt.Sprintf("can't write response: %v", err), http.StatusInternalServerError)
+			writeError(w, r, fmt.Errorf("can't write response: %w", err))
 			return
 		}
 	}
 }
 
-func ItemPurchase(svc service.Item) http.HandlerFunc {
+// checkoutCart reserves all the items listed in request body with a single code.
+// Units of the same item may be listed either as its ID repeated in item_ids or with quantity in items.
+func checkoutCart(svc service.Item, w http.ResponseWriter, r *http.Request) {
+	var req CheckoutCartReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, apierror.BadRequest("can't decode request: %v", err))
+		return
+	}
+
+	if req.UserID == 0 {
+		writeError(w, r, apierror.BadRequest("invalid user_id: %d", 0))
+		return
+	}
+
+	items, err := cartItems(req.ItemIDs, req.Items)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+
+	code, err := svc.CheckoutCart(ctx, req.UserID, items)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	resp := []byte(fmt.Sprintf(`{"code":"%s"}`, code))
+	if _, err := w.Write(resp); err != nil {
+		writeError(w, r, fmt.Errorf("can't write response: %w", err))
+		return
+	}
+}
+
+// cartItems lists units of item_ids along with items, so they are merged into the cart.
+func cartItems(itemIDs []int, items []model.CartItem) ([]model.CartItem, error) {
+	all := make([]model.CartItem, 0, len(itemIDs)+len(items))
+	for _, itemID := range itemIDs {
+		all = append(all, model.CartItem{ItemID: itemID, Quantity: 1})
+	}
+
+	return model.NewCart(append(all, items...))
+}
+
+func ItemCheckoutAny(svc service.Item) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "only POST method allowed", http.StatusMethodNotAllowed)
+			writeError(w, r, apierror.MethodNotAllowed(http.MethodPost))
 			return
 		}
 
-		code := r.URL.Query().Get("code")
-		if code == "" {
-			http.Error(w, "no code provided", http.StatusBadRequest)
+		q := r.URL.Query()
+
+		userID, err := strconv.Atoi(q.Get("user_id"))
+		if err != nil {
+			writeError(w, r, apierror.BadRequest("can't parse user_id: %v", err))
 			return
 		}
 
-		var cc model.CheckoutCode
-		if err := cc.FromString(code); err != nil {
-			http.Error(w, fmt.Sprintf("invalid code: %v", err), http.StatusBadRequest)
+		saleID, err := strconv.Atoi(q.Get("sale_id"))
+		if err != nil {
+			writeError(w, r, apierror.BadRequest("can't parse sale_id: %v", err))
 			return
 		}
 
-		err := svc.Purchase(r.Context(), cc)
-		switch {
-		case errors.Is(err, database.ErrNotFound):
-			http.Error(w, "no check out for given code found", http.StatusNotFound)
-		case errors.Is(err, service.ErrLimitExceeded):
-			http.Error(w, err.Error(), http.StatusTooManyRequests)
-		case err != nil:
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if userID == 0 {
+			writeError(w, r, apierror.BadRequest("invalid user_id: %d", 0))
+			return
 		}
 
-		return
+		if saleID == 0 {
+			writeError(w, r, apierror.BadRequest("invalid sale_id: %d", 0))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+		defer cancel()
+
+		var resp CheckoutAnyResp
+
+		resp.Code, resp.ItemID, err = svc.CheckoutAny(ctx, userID, saleID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			writeError(w, r, fmt.Errorf("can't encode response: %w", err))
+			return
+		}
 	}
 }
 
-func ItemListPage(svc service.Item) http.HandlerFunc {
+func ItemPurchase(svc service.Item, signer model.CodeSigner) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "only GET method allowed", http.StatusMethodNotAllowed)
+		if r.Method != http.MethodPost {
+			writeError(w, r, apierror.MethodNotAllowed(http.MethodPost))
 			return
 		}
 
-		var (
-			q        = r.URL.Query()
-			pageNum  = service.DefaultPageNum
-			pageSize = service.DefaultPageSize
-			err      error
-		)
+		cc, ok := parseCode(w, r, signer)
+		if !ok {
+			return
+		}
 
-		if pn := q.Get("page_num"); pn != "" {
-			pageNum, err = strconv.Atoi(q.Get("page_num"))
-			if err != nil {
-				http.Error(w, fmt.Sprintf("can't parse page_num: %v", err), http.StatusBadRequest)
-				return
-			}
+		orders, err := svc.Purchase(r.Context(), cc)
+		if err != nil {
+			writeError(w, r, err)
+			return
 		}
 
-		if ps := q.Get("page_size"); ps != "" {
-			pageSize, err = strconv.Atoi(q.Get("page_size"))
-			if err != nil {
-				http.Error(w, fmt.Sprintf("can't parse page_size: %v", err), http.StatusBadRequest)
-				return
-			}
+		resp := PurchaseResp{
+			ItemIDs: make([]int, 0, len(orders)),
+			Orders:  orders,
 		}
 
-		var resp ListPageResp[model.Item]
+		for _, o := range orders {
+			resp.ItemIDs = append(resp.ItemIDs, o.ItemID)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			writeError(w, r, fmt.Errorf("can't encode response: %w", err))
+			return
+		}
+	}
+}
+
+func ItemCancel(svc service.Item, signer model.CodeSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, r, apierror.MethodNotAllowed(http.MethodPost))
+			return
+		}
+
+		cc, ok := parseCode(w, r, signer)
+		if !ok {
+			return
+		}
 
-		resp.Page, resp.Total, err = svc.ListPage(r.Context(), pageNum, pageSize)
+		_, err := svc.Cancel(r.Context(), cc)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
+		}
+
+		return
+	}
+}
+
+func ItemExtend(svc service.Item, signer model.CodeSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, r, apierror.MethodNotAllowed(http.MethodPost))
+			return
+		}
+
+		cc, ok := parseCode(w, r, signer)
+		if !ok {
 			return
 		}
 
+		until, err := svc.Extend(r.Context(), cc)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// the code carries expiration, so it has to be reissued
+		cc.Expires = until
+		resp := ExtendResp{Code: signer.Sign(cc), ReservedUntil: until}
+
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			http.Error(w, fmt.Sprintf("can't encode response: %v", err), http.StatusInternalServerError)
+			writeError(w, r, fmt.Errorf("can't encode response: %w", err))
+			return
+		}
+	}
+}
+
+// parseCode verifies checkout code from query and rejects the expired ones without going to DB.
+// If false is returned, the response has already been written.
+func parseCode(w http.ResponseWriter, r *http.Request, signer model.CodeSigner) (model.CheckoutCode, bool) {
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		writeError(w, r, apierror.BadRequest("no code provided"))
+		return model.CheckoutCode{}, false
+	}
+
+	cc, err := signer.Verify(code)
+	if err != nil {
+		writeError(w, r, err)
+		return cc, false
+	}
+
+	if cc.Expired(time.Now()) {
+		writeError(w, r, database.ErrNotFound)
+		return cc, false
+	}
+
+	return cc, true
+}
+
+func ItemListPage(svc service.Item) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, r, apierror.MethodNotAllowed(http.MethodGet))
+			return
+		}
+
+		filter, ok := parseItemFilter(w, r)
+		if !ok {
+			return
+		}
+
+		listItems(w, r, svc, filter)
+	}
+}
+
+// SaleItems lists items of the sale taken from the path, see ItemListPage.
+func SaleItems(itemSvc service.Item, saleSvc service.Sale) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		saleID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		filter, ok := parseItemFilter(w, r)
+		if !ok {
+			return
+		}
+
+		filter.SaleID = saleID
+
+		if _, err := saleSvc.Get(r.Context(), saleID); err != nil {
+			writeError(w, r, err)
 			return
 		}
+
+		listItems(w, r, itemSvc, filter)
+	}
+}
+
+// listItems writes a page of items matching the filter, using either page_num or cursor pagination.
+func listItems(w http.ResponseWriter, r *http.Request, svc service.Item, filter model.ItemFilter) {
+	pageNum, pageSize, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	cursor, keyset, estimate, ok := parseCursor(w, r)
+	if !ok {
+		return
+	}
+
+	var (
+		resp  ListPageResp[model.Item]
+		total int
+		err   error
+	)
+
+	if keyset {
+		var next *model.Cursor
+
+		resp.Page, next, err = svc.ListPageAfter(r.Context(), filter, cursor, pageSize)
+		if next != nil {
+			resp.NextCursor = next.String()
+		}
+
+		if err == nil && estimate {
+			total, err = svc.EstimateTotal(r.Context(), filter)
+			resp.TotalEstimate = &total
+		}
+	} else {
+		resp.Page, total, err = svc.ListPage(r.Context(), filter, pageNum, pageSize)
+		resp.Total = &total
 	}
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		writeError(w, r, fmt.Errorf("can't encode response: %w", err))
+		return
+	}
+}
+
+// parseItemFilter parses sale_id, sold, available_now, search and sort query params.
+// If false is returned, the response has already been written.
+func parseItemFilter(w http.ResponseWriter, r *http.Request) (model.ItemFilter, bool) {
+	var (
+		q      = r.URL.Query()
+		filter = model.ItemFilter{Search: q.Get("search"), Sort: q.Get("sort")}
+		err    error
+	)
+
+	if v := q.Get("sale_id"); v != "" {
+		filter.SaleID, err = strconv.Atoi(v)
+		if err != nil {
+			writeError(w, r, apierror.BadRequest("can't parse sale_id: %v", err))
+			return filter, false
+		}
+	}
+
+	if v := q.Get("sold"); v != "" {
+		sold, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, apierror.BadRequest("can't parse sold: %v", err))
+			return filter, false
+		}
+
+		filter.Sold = &sold
+	}
+
+	if v := q.Get("available_now"); v != "" {
+		filter.AvailableNow, err = strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, apierror.BadRequest("can't parse available_now: %v", err))
+			return filter, false
+		}
+	}
+
+	return filter, true
 }
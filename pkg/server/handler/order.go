@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+	"github.com/IlyushaZ/not-back-contest/pkg/server/apierror"
+	"github.com/IlyushaZ/not-back-contest/pkg/service"
+)
+
+// Handlers below are meant to be registered with method-specific patterns under /admin/orders.
+
+func OrderRefund(svc service.Item) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		var req model.RefundRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, apierror.BadRequest("can't decode request: %v", err))
+			return
+		}
+
+		// if payment provider times out, the refund is left pending, as money may have been returned,
+		// and its units can't be refunded again until it's reconciled
+		refund, err := svc.Refund(r.Context(), id, req)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, refund)
+	}
+}
@@ -3,55 +3,301 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/IlyushaZ/not-back-contest/pkg/model"
+	"github.com/IlyushaZ/not-back-contest/pkg/server/apierror"
 	"github.com/IlyushaZ/not-back-contest/pkg/service"
 )
 
 func SaleListPage(svc service.Sale) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			http.Error(w, "only GET method allowed", http.StatusMethodNotAllowed)
+			writeError(w, r, apierror.MethodNotAllowed(http.MethodGet))
+			return
+		}
+
+		pageNum, pageSize, ok := parsePage(w, r)
+		if !ok {
+			return
+		}
+
+		cursor, keyset, estimate, ok := parseCursor(w, r)
+		if !ok {
 			return
 		}
 
 		var (
-			q        = r.URL.Query()
-			pageNum  = service.DefaultPageNum
-			pageSize = service.DefaultPageSize
-			err      error
+			resp  ListPageResp[model.Sale]
+			total int
+			err   error
 		)
 
-		if pn := q.Get("page_num"); pn != "" {
-			pageNum, err = strconv.Atoi(q.Get("page_num"))
-			if err != nil {
-				http.Error(w, fmt.Sprintf("can't parse page_num: %v", err), http.StatusBadRequest)
+		if keyset {
+			var next *model.Cursor
+
+			resp.Page, next, err = svc.ListPageAfter(r.Context(), cursor, pageSize)
+			if next != nil {
+				resp.NextCursor = next.String()
+			}
+
+			if err == nil && estimate {
+				total, err = svc.EstimateTotal(r.Context())
+				resp.TotalEstimate = &total
+			}
+		} else {
+			resp.Page, total, err = svc.ListPage(r.Context(), pageNum, pageSize)
+			resp.Total = &total
+		}
+
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			writeError(w, r, fmt.Errorf("can't encode response: %w", err))
+			return
+		}
+	}
+}
+
+func SaleCurrent(svc service.Sale) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sales, err := svc.Current(r.Context())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeSaleStatus(w, r, svc, sales)
+	}
+}
+
+func SaleUpcoming(svc service.Sale) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := service.DefaultPageSize
+
+		if v := r.URL.Query().Get("limit"); v != "" {
+			var err error
+
+			limit, err = strconv.Atoi(v)
+			if err != nil || limit <= 0 {
+				writeError(w, r, apierror.BadRequest("invalid limit: %q", v))
 				return
 			}
 		}
 
-		if ps := q.Get("page_size"); ps != "" {
-			pageSize, err = strconv.Atoi(q.Get("page_size"))
-			if err != nil {
-				http.Error(w, fmt.Sprintf("can't parse page_size: %v", err), http.StatusBadRequest)
+		sales, err := svc.Upcoming(r.Context(), limit)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeSaleStatus(w, r, svc, sales)
+	}
+}
+
+// writeSaleStatus writes the sales along with their countdowns and stats.
+// Countdowns are rounded up, so clients don't come a bit before the sale starts.
+func writeSaleStatus(w http.ResponseWriter, r *http.Request, svc service.Sale, sales []model.Sale) {
+	ids := make([]int, 0, len(sales))
+	for _, sale := range sales {
+		ids = append(ids, sale.ID)
+	}
+
+	stats, err := svc.Stats(r.Context(), ids)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	now := time.Now()
+
+	resp := SaleStatusResp{
+		ServerTime: now,
+		Sales:      make([]SaleStatus, 0, len(sales)),
+	}
+
+	for _, sale := range sales {
+		resp.Sales = append(resp.Sales, SaleStatus{
+			Sale:     sale,
+			StartsIn: secondsUntil(now, sale.StartAt),
+			EndsIn:   secondsUntil(now, sale.EndAt),
+			Stats:    stats[sale.ID],
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func secondsUntil(now, t time.Time) int {
+	return max(int(math.Ceil(t.Sub(now).Seconds())), 0)
+}
+
+// Handlers below are meant to be registered with method-specific patterns under /admin/sales,
+// so they don't check request method themselves.
+
+func SaleCreate(svc service.Sale) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req SaleCreateReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, apierror.BadRequest("can't decode request: %v", err))
+			return
+		}
+
+		items := make([]model.Item, 0, len(req.Items))
+		for i, item := range req.Items {
+			if item.Name == "" {
+				writeError(w, r, apierror.BadRequest("item #%d has no name", i))
 				return
 			}
+
+			quantity := item.Quantity
+			if quantity == 0 {
+				quantity = 1
+			} else if quantity < 0 {
+				writeError(w, r, apierror.BadRequest("item #%d has invalid quantity: %d", i, quantity))
+				return
+			}
+
+			items = append(items, model.Item{
+				Name:          item.Name,
+				Quantity:      quantity,
+				Price:         item.Price,
+				OriginalPrice: item.OriginalPrice,
+				Currency:      item.Currency,
+			})
+		}
+
+		sale, err := svc.Create(r.Context(), req.StartAt, req.EndAt, req.SaleSettings, items)
+		if err != nil {
+			writeError(w, r, err)
+			return
 		}
 
-		var resp ListPageResp[model.Sale]
+		resp := SaleCreateResp{Sale: sale, ItemIDs: make([]int, 0, len(items))}
+		for _, item := range items {
+			resp.ItemIDs = append(resp.ItemIDs, item.ID)
+		}
 
-		resp.Page, resp.Total, err = svc.ListPage(r.Context(), pageNum, pageSize)
+		writeJSON(w, http.StatusCreated, resp)
+	}
+}
+
+func SaleGet(svc service.Sale) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		sale, err := svc.Get(r.Context(), id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			http.Error(w, fmt.Sprintf("can't encode response: %v", err), http.StatusInternalServerError)
+		writeJSON(w, http.StatusOK, sale)
+	}
+}
+
+func SaleUpdateWindow(svc service.Sale) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		var req SaleWindowReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, apierror.BadRequest("can't decode request: %v", err))
+			return
+		}
+
+		sale, err := svc.UpdateWindow(r.Context(), id, req.StartAt, req.EndAt)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, sale)
+	}
+}
+
+func SaleUpdateSettings(svc service.Sale) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		var req model.SaleSettings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, apierror.BadRequest("can't decode request: %v", err))
+			return
+		}
+
+		sale, err := svc.UpdateSettings(r.Context(), id, req)
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
+
+		writeJSON(w, http.StatusOK, sale)
+	}
+}
+
+func SalePause(svc service.Sale) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		sale, err := svc.Pause(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, sale)
+	}
+}
+
+func SaleResume(svc service.Sale) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		sale, err := svc.Resume(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, sale)
+	}
+}
+
+func SaleDelete(svc service.Sale) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		if err := svc.Delete(r.Context(), id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/events"
+	"github.com/IlyushaZ/not-back-contest/pkg/server/apierror"
+	"github.com/IlyushaZ/not-back-contest/pkg/service"
+)
+
+const (
+	// heartbeatInterval is how often a comment is sent to idle streams, so proxies don't close them.
+	heartbeatInterval = 15 * time.Second
+	// streamWriteTimeout bounds each write to the stream instead of the server's write timeout,
+	// which would otherwise close the stream.
+	streamWriteTimeout = 5 * time.Second
+	// retryInterval is how long browsers wait before reconnecting, in milliseconds.
+	retryInterval = 3000
+)
+
+// SaleEvents streams changes of stock of the sale's items as server-sent events.
+// Stream is resumed from the event following Last-Event-ID header (or last_event_id param), if it's still kept.
+// Otherwise "reset" event is sent first, meaning that client has to refetch the items.
+// Clients which don't keep up with the stream are disconnected and expected to reconnect.
+func SaleEvents(saleSvc service.Sale, bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		saleID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		lastID, ok := parseLastEventID(w, r)
+		if !ok {
+			return
+		}
+
+		if _, err := saleSvc.Get(r.Context(), saleID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		rc := http.NewResponseController(w)
+
+		sub, backlog, reset := bus.Subscribe(saleID, lastID)
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		write := func(s string) error {
+			if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return err
+			}
+
+			if _, err := fmt.Fprint(w, s); err != nil {
+				return err
+			}
+
+			return rc.Flush()
+		}
+
+		if err := write("retry: " + strconv.Itoa(retryInterval) + "\n\n"); err != nil {
+			return
+		}
+
+		if reset {
+			// no id, so the client keeps its Last-Event-ID until the next event
+			backlog = append([]events.Event{{Kind: events.KindReset, SaleID: saleID, At: time.Now()}}, backlog...)
+		}
+
+		for _, e := range backlog {
+			if err := write(formatSSE(e)); err != nil {
+				return
+			}
+		}
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+
+			case <-heartbeat.C:
+				if err := write(": ping\n\n"); err != nil {
+					return
+				}
+
+			case e, ok := <-sub.C:
+				if !ok {
+					// dropped for falling behind
+					return
+				}
+
+				if err := write(formatSSE(e)); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// parseLastEventID parses Last-Event-ID header or last_event_id param, zero is returned if neither is set.
+// If false is returned, the response has already been written.
+func parseLastEventID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	s := r.Header.Get("Last-Event-ID")
+	if s == "" {
+		s = r.URL.Query().Get("last_event_id")
+	}
+
+	if s == "" {
+		return 0, true
+	}
+
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id < 0 {
+		writeError(w, r, apierror.BadRequest("invalid last event id: %q", s))
+		return 0, false
+	}
+
+	return id, true
+}
+
+func formatSSE(e events.Event) string {
+	data, _ := json.Marshal(e) // can't fail for events
+
+	var s string
+	if e.ID != 0 {
+		s = "id: " + strconv.FormatInt(e.ID, 10) + "\n"
+	}
+
+	return s + "event: " + string(e.Kind) + "\ndata: " + string(data) + "\n\n"
+}
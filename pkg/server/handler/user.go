@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+	"github.com/IlyushaZ/not-back-contest/pkg/service"
+)
+
+// Handlers below are meant to be registered with method-specific patterns under /users/{id}.
+
+func UserPurchases(svc service.Item) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		pageNum, pageSize, ok := parsePage(w, r)
+		if !ok {
+			return
+		}
+
+		orders, total, err := svc.ListPurchases(r.Context(), userID, pageNum, pageSize)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, ListPageResp[model.Order]{Page: orders, Total: &total})
+	}
+}
+
+// UserReservations lists the reservations without their codes: users are identified by X-User-ID header,
+// which can't be verified by the service, so nobody can be trusted to be the owner of the code.
+func UserReservations(svc service.Item) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		pageNum, pageSize, ok := parsePage(w, r)
+		if !ok {
+			return
+		}
+
+		rs, total, err := svc.ListReservations(r.Context(), userID, pageNum, pageSize)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, ListPageResp[model.Reservation]{Page: rs, Total: &total})
+	}
+}
@@ -0,0 +1,393 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/database"
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+	"github.com/IlyushaZ/not-back-contest/pkg/payment"
+	"github.com/IlyushaZ/not-back-contest/pkg/server/apierror"
+	"github.com/IlyushaZ/not-back-contest/pkg/server/middleware"
+	"github.com/IlyushaZ/not-back-contest/pkg/service"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+const (
+	wsCommandTimeout = time.Second
+	wsWriteTimeout   = 5 * time.Second
+	wsPingInterval   = 30 * time.Second
+	// wsCheckInterval is how often reservations are checked for expiration.
+	wsCheckInterval = time.Second
+	// wsReservationsPage is the max number of reservations made before connecting which are tracked.
+	wsReservationsPage = 100
+)
+
+// ItemWebSocket lets the user send checkout, purchase, cancel and extend commands over a single connection,
+// see WSReq and WSResp. The user is taken from X-User-ID header, codes of other users are treated as not found.
+// Reservations of the user, including the ones made before connecting, are tracked, so "expiring" message
+// is pushed warnBefore reservation expires and "expired" message once it has.
+func ItemWebSocket(svc service.Item, signer model.CodeSigner, origins []string, warnBefore time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := middleware.UserIDFrom(r.Context())
+		if !ok {
+			writeError(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "X-User-ID header required"))
+			return
+		}
+
+		// connection outlives server's timeouts, which are set on it before the handler is called
+		rc := http.NewResponseController(w)
+		if err := rc.SetReadDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			writeError(w, r, err)
+			return
+		}
+
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			writeError(w, r, err)
+			return
+		}
+
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: origins})
+		if err != nil {
+			// response has already been written
+			return
+		}
+		defer conn.CloseNow()
+
+		s := &wsSession{
+			conn:         conn,
+			svc:          svc,
+			signer:       signer,
+			userID:       userID,
+			warnBefore:   warnBefore,
+			reservations: make(map[wsKey]*wsReservation),
+		}
+
+		s.serve(r.Context())
+	}
+}
+
+type wsSession struct {
+	conn       *websocket.Conn
+	svc        service.Item
+	signer     model.CodeSigner
+	userID     int
+	warnBefore time.Duration
+
+	mu           sync.Mutex
+	reservations map[wsKey]*wsReservation
+}
+
+// wsKey identifies the reservation regardless of the code it's referred with, since the code changes on extension.
+type wsKey struct {
+	itemID int
+	rand   string
+}
+
+type wsReservation struct {
+	code   string
+	until  time.Time
+	warned bool
+}
+
+func (s *wsSession) serve(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.restore(ctx)
+
+	go s.watch(ctx, cancel)
+
+	for {
+		var req WSReq
+		if err := wsjson.Read(ctx, s.conn, &req); err != nil {
+			if websocket.CloseStatus(err) == -1 && ctx.Err() == nil {
+				slog.Debug("websocket closed", slog.Int("user_id", s.userID), slog.Any("error", err))
+			}
+
+			return
+		}
+
+		if err := s.write(ctx, s.handle(ctx, req)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *wsSession) handle(ctx context.Context, req WSReq) WSResp {
+	resp := WSResp{ID: req.ID, Type: req.Type, Status: http.StatusOK}
+
+	switch req.Type {
+	case "checkout":
+		return s.checkout(ctx, req, resp)
+	case "purchase", "cancel", "extend":
+	default:
+		return wsError(resp, apierror.BadRequest("unknown command type: %q", req.Type))
+	}
+
+	cc, err := s.parseCode(req.Code)
+	if err != nil {
+		return wsError(resp, err)
+	}
+
+	switch req.Type {
+	case "purchase":
+		orders, err := s.svc.Purchase(ctx, cc)
+		if err != nil {
+			// declined payment releases the reservation, while the timed out one is kept
+			if errors.Is(err, payment.ErrDeclined) || errors.Is(err, database.ErrNotFound) {
+				s.untrack(cc)
+			}
+
+			return wsError(resp, err)
+		}
+
+		s.untrack(cc)
+
+		resp.Orders = orders
+
+	case "cancel":
+		ctx, cancel := context.WithTimeout(ctx, wsCommandTimeout)
+		defer cancel()
+
+		items, err := s.svc.Cancel(ctx, cc)
+		if err != nil {
+			if errors.Is(err, database.ErrNotFound) {
+				s.untrack(cc)
+			}
+
+			return wsError(resp, err)
+		}
+
+		s.untrack(cc)
+		resp.Items = items
+
+	case "extend":
+		ctx, cancel := context.WithTimeout(ctx, wsCommandTimeout)
+		defer cancel()
+
+		until, err := s.svc.Extend(ctx, cc)
+		if err != nil {
+			return wsError(resp, err)
+		}
+
+		// the code carries expiration, so it has to be reissued
+		cc.Expires = until
+		resp.Code = s.signer.Sign(cc)
+		resp.ReservedUntil = &until
+
+		s.track(cc, resp.Code, until)
+	}
+
+	return resp
+}
+
+func (s *wsSession) checkout(ctx context.Context, req WSReq, resp WSResp) WSResp {
+	ctx, cancel := context.WithTimeout(ctx, wsCommandTimeout)
+	defer cancel()
+
+	var (
+		code string
+		err  error
+	)
+
+	if len(req.ItemIDs) > 0 || len(req.Items) > 0 {
+		items, err := cartItems(req.ItemIDs, req.Items)
+		if err != nil {
+			return wsError(resp, err)
+		}
+
+		code, err = s.svc.CheckoutCart(ctx, s.userID, items)
+		if err != nil {
+			return wsError(resp, err)
+		}
+	} else {
+		quantity := req.Quantity
+		if quantity == 0 {
+			quantity = 1
+		}
+
+		if req.ItemID <= 0 || quantity < 0 {
+			return wsError(resp, apierror.BadRequest("invalid item_id %d or quantity %d", req.ItemID, quantity))
+		}
+
+		code, err = s.svc.Checkout(ctx, s.userID, req.ItemID, quantity)
+		if err != nil {
+			return wsError(resp, err)
+		}
+	}
+
+	resp.Code = code
+
+	cc, err := s.signer.Verify(code)
+	if err != nil {
+		slog.Error("can't parse issued checkout code", slog.Any("error", err))
+		return resp
+	}
+
+	if cc.Expires.IsZero() {
+		// legacy codes don't carry expiration, so it's taken from the database
+		s.restore(ctx)
+	} else {
+		s.track(cc, code, cc.Expires)
+	}
+
+	if until, ok := s.until(cc); ok {
+		resp.ReservedUntil = &until
+	}
+
+	return resp
+}
+
+// parseCode parses the code and makes sure it belongs to the user and hasn't expired.
+func (s *wsSession) parseCode(code string) (model.CheckoutCode, error) {
+	if code == "" {
+		return model.CheckoutCode{}, fmt.Errorf("%w: no code provided", model.ErrInvalidCode)
+	}
+
+	cc, err := s.signer.Verify(code)
+	if err != nil {
+		return cc, err
+	}
+
+	if cc.UserID != s.userID || cc.Expired(time.Now()) {
+		return cc, database.ErrNotFound
+	}
+
+	return cc, nil
+}
+
+// restore tracks reservations of the user which are active at the moment.
+func (s *wsSession) restore(ctx context.Context) {
+	reservations, _, err := s.svc.ListReservations(ctx, s.userID, 1, wsReservationsPage)
+	if err != nil {
+		slog.Error("can't get reservations of user", slog.Int("user_id", s.userID), slog.Any("error", err))
+		return
+	}
+
+	for _, r := range reservations {
+		s.track(r.Code, s.signer.Sign(r.Code), r.ReservedUntil)
+	}
+}
+
+func (s *wsSession) track(cc model.CheckoutCode, code string, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := wsKey{cc.ItemID, cc.Rand}
+
+	r, ok := s.reservations[key]
+	if !ok {
+		s.reservations[key] = &wsReservation{code: code, until: until}
+		return
+	}
+
+	if until.After(r.until) {
+		r.code, r.until, r.warned = code, until, false
+	}
+}
+
+func (s *wsSession) untrack(cc model.CheckoutCode) {
+	s.mu.Lock()
+	delete(s.reservations, wsKey{cc.ItemID, cc.Rand})
+	s.mu.Unlock()
+}
+
+func (s *wsSession) until(cc model.CheckoutCode) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.reservations[wsKey{cc.ItemID, cc.Rand}]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return r.until, true
+}
+
+// watch pushes warnings about expiring reservations and pings the client, closing the connection if it's gone.
+func (s *wsSession) watch(ctx context.Context, cancel context.CancelFunc) {
+	defer cancel()
+
+	check := time.NewTicker(wsCheckInterval)
+	defer check.Stop()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ping.C:
+			pingCtx, pingCancel := context.WithTimeout(ctx, wsWriteTimeout)
+			err := s.conn.Ping(pingCtx)
+			pingCancel()
+
+			if err != nil {
+				return
+			}
+
+		case now := <-check.C:
+			for _, msg := range s.expiring(now) {
+				if err := s.write(ctx, msg); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// expiring returns messages about reservations which are about to expire or have expired,
+// the latter ones are not tracked anymore.
+func (s *wsSession) expiring(now time.Time) []WSResp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var msgs []WSResp
+
+	for key, r := range s.reservations {
+		until := r.until
+
+		switch {
+		case !now.Before(until):
+			delete(s.reservations, key)
+			msgs = append(msgs, WSResp{Type: "expired", Status: http.StatusOK, Code: r.code, ReservedUntil: &until})
+
+		case !r.warned && until.Sub(now) <= s.warnBefore:
+			r.warned = true
+
+			expiresIn := secondsUntil(now, until)
+			msgs = append(msgs, WSResp{Type: "expiring", Status: http.StatusOK, Code: r.code, ReservedUntil: &until, ExpiresIn: &expiresIn})
+		}
+	}
+
+	return msgs
+}
+
+func (s *wsSession) write(ctx context.Context, msg WSResp) error {
+	ctx, cancel := context.WithTimeout(ctx, wsWriteTimeout)
+	defer cancel()
+
+	return wsjson.Write(ctx, s.conn, msg)
+}
+
+// wsError sets the status and the error the same way as HTTP handlers do.
+func wsError(resp WSResp, err error) WSResp {
+	e := apierror.From(err)
+	if e.Status == http.StatusInternalServerError {
+		slog.Error("websocket command failed", slog.String("type", resp.Type), slog.Any("error", err))
+	}
+
+	resp.Status = e.Status
+	resp.Error = e
+
+	return resp
+}
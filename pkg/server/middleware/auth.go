@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/server/apierror"
+)
+
+// AdminAuth lets through only requests bearing the token in Authorization header.
+// If token is empty, all the requests are rejected.
+func AdminAuth(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "unauthorized"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type ctxKey int
+
+const userIDKey ctxKey = iota
+
+// UserID puts ID of the user who made the request into its context. The ID is taken from X-User-ID header,
+// which is expected to be set by the gateway authenticating users, since the service doesn't do it itself.
+// Requests without the header are let through as anonymous ones.
+func UserID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := r.Header.Get("X-User-ID")
+		if h == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userID, err := strconv.Atoi(h)
+		if err != nil || userID <= 0 {
+			apierror.Write(w, r, apierror.BadRequest("invalid X-User-ID header"))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userIDKey, userID)))
+	})
+}
+
+// UserIDFrom returns ID of the user who made the request, false if the request is anonymous.
+func UserIDFrom(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(userIDKey).(int)
+	return userID, ok
+}
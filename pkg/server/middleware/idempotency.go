@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/idempotency"
+	"github.com/IlyushaZ/not-back-contest/pkg/server/apierror"
+)
+
+const (
+	maxIdempotencyKeyLen = 255
+	// maxIdempotentBody bounds the body which is read in full to fingerprint the request.
+	maxIdempotentBody = 1 << 20
+)
+
+// Idempotency replays the response to the request made with the same Idempotency-Key header, so retries of requests
+// which have succeeded don't fail or get applied twice. Keys are scoped by path and X-User-ID, and may be reused
+// only for the same request, i.e. with the same method, query and body. Requests with the key which is in progress
+// wait for it to be completed. Server errors are not saved, so such requests may be retried with the same key.
+// Requests without the header are let through as is.
+func Idempotency(store *idempotency.Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > maxIdempotencyKeyLen {
+				apierror.Write(w, r, apierror.BadRequest("Idempotency-Key header must be at most %d characters", maxIdempotencyKeyLen))
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+			if err != nil {
+				apierror.Write(w, r, apierror.BadRequest("can't read request: %v", err))
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			userID, _ := UserIDFrom(r.Context())
+			key = hash(r.URL.Path, strconv.Itoa(userID), key)
+
+			lock, saved, err := store.Acquire(r.Context(), key, hash(r.Method, r.URL.RawQuery, string(body)))
+			if err != nil {
+				e := apierror.From(err)
+				if e.Code == apierror.CodeIdempotencyKeyInUse {
+					e.RetryAfter = 1
+				}
+
+				apierror.Write(w, r, e)
+				return
+			}
+
+			if saved != nil {
+				for k, v := range saved.Header {
+					w.Header()[k] = v
+				}
+
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(saved.Status)
+				w.Write(saved.Body)
+				return
+			}
+
+			rec := &recorder{ResponseWriter: w}
+
+			// the response is saved even if the client has gone, since the request has been made anyway
+			ctx := context.WithoutCancel(r.Context())
+			completed := false
+
+			defer func() {
+				if completed {
+					return
+				}
+
+				// the handler has panicked
+				if err := lock.Abort(ctx); err != nil {
+					slog.Error("can't unlock idempotency key", slog.Any("error", err))
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+
+			resp := rec.response()
+			completed = true
+
+			if resp.Status >= http.StatusInternalServerError {
+				if err := lock.Abort(ctx); err != nil {
+					slog.Error("can't unlock idempotency key", slog.Any("error", err))
+				}
+
+				return
+			}
+
+			if err := lock.Complete(ctx, resp); err != nil {
+				slog.Error("can't save idempotent response", slog.Any("error", err))
+			}
+		})
+	}
+}
+
+func hash(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recorder copies the response written to the client, so it can be saved.
+type recorder struct {
+	http.ResponseWriter
+
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (rec *recorder) WriteHeader(statusCode int) {
+	if rec.header == nil {
+		rec.status = statusCode
+		rec.header = rec.Header().Clone()
+	}
+
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.header == nil {
+		rec.WriteHeader(http.StatusOK)
+	}
+
+	rec.body.Write(b)
+
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+func (rec *recorder) response() idempotency.Response {
+	if rec.header == nil {
+		return idempotency.Response{Status: http.StatusOK, Header: rec.Header().Clone()}
+	}
+
+	return idempotency.Response{Status: rec.status, Header: rec.header, Body: rec.body.Bytes()}
+}
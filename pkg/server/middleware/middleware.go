@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"runtime/debug"
 	"time"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/server/apierror"
 )
 
 func Recovery(next http.Handler) http.Handler {
@@ -22,7 +24,7 @@ func Recovery(next http.Handler) http.Handler {
 					debug.PrintStack()
 				}
 
-				w.WriteHeader(http.StatusInternalServerError)
+				apierror.Write(w, r, apierror.New(http.StatusInternalServerError, apierror.CodeInternal, "internal error"))
 			}
 		}()
 
@@ -49,6 +51,11 @@ func (rw *responseWriter) WriteHeader(statusCode int) {
 	rw.ResponseWriter.WriteHeader(statusCode)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush streamed responses.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func Log(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if slog.Default().Enabled(nil, slog.LevelDebug) {
@@ -0,0 +1,72 @@
+package rpc
+
+import (
+	"time"
+
+	pb "github.com/IlyushaZ/not-back-contest/api/flashsale/v1"
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var availabilities = map[model.ItemAvailability]pb.ItemAvailability{
+	model.ItemAvailable: pb.ItemAvailability_ITEM_AVAILABILITY_AVAILABLE,
+	model.ItemReserved:  pb.ItemAvailability_ITEM_AVAILABILITY_RESERVED,
+	model.ItemSold:      pb.ItemAvailability_ITEM_AVAILABILITY_SOLD,
+}
+
+func itemFilter(req *pb.ListItemsRequest) model.ItemFilter {
+	return model.ItemFilter{
+		SaleID:       int(req.SaleId),
+		Sold:         req.Sold,
+		AvailableNow: req.AvailableNow,
+		Search:       req.Search,
+		Sort:         req.Sort,
+	}
+}
+
+func itemToPB(i model.Item) *pb.Item {
+	return &pb.Item{
+		Id:                int64(i.ID),
+		CreatedAt:         timestamppb.New(i.CreatedAt),
+		Name:              i.Name,
+		SaleId:            int64(i.SaleID),
+		Sold:              i.Sold,
+		Quantity:          int32(i.Quantity),
+		AvailableQuantity: int32(i.AvailableQuantity),
+		ReservedQuantity:  int32(i.ReservedQuantity),
+		SoldQuantity:      int32(i.SoldQuantity),
+		Availability:      availabilities[i.Availability],
+		Price:             i.Price,
+		OriginalPrice:     i.OriginalPrice,
+		Currency:          i.Currency,
+		DiscountPercent:   int32(i.DiscountPercent),
+	}
+}
+
+func orderToPB(o model.Order) *pb.Order {
+	return &pb.Order{
+		Id:               int64(o.ID),
+		CreatedAt:        timestamppb.New(o.CreatedAt),
+		UserId:           int64(o.UserID),
+		ItemId:           int64(o.ItemID),
+		SaleId:           int64(o.SaleID),
+		Quantity:         int32(o.Quantity),
+		Price:            o.Price,
+		OriginalPrice:    o.OriginalPrice,
+		Currency:         o.Currency,
+		RefundedQuantity: int32(o.RefundedQuantity),
+	}
+}
+
+func saleToPB(s model.Sale) *pb.Sale {
+	return &pb.Sale{
+		Id:                     int64(s.ID),
+		CreatedAt:              timestamppb.New(s.CreatedAt),
+		StartAt:                timestamppb.New(s.StartAt),
+		EndAt:                  timestamppb.New(s.EndAt),
+		Paused:                 s.Paused,
+		PurchasesLimit:         int32(s.PurchasesLimit),
+		CheckoutTimeoutSeconds: int64(time.Duration(s.CheckoutTimeout) / time.Second),
+		ItemsCount:             int32(s.ItemsCount),
+	}
+}
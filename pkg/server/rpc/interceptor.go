@@ -0,0 +1,91 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/database"
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+	"github.com/IlyushaZ/not-back-contest/pkg/payment"
+	"github.com/IlyushaZ/not-back-contest/pkg/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statusError maps errors of the services to status codes, see the description of FlashSale service.
+// Unknown errors are logged and reported as internal ones without any details.
+func statusError(err error) error {
+	var code codes.Code
+
+	switch {
+	case errors.Is(err, model.ErrInvalidCart), errors.Is(err, model.ErrInvalidCode), errors.Is(err, model.ErrInvalidCursor), errors.Is(err, model.ErrInvalidItemFilter):
+		code = codes.InvalidArgument
+	case errors.Is(err, database.ErrNotFound):
+		return status.Error(codes.NotFound, "not found")
+	case errors.Is(err, model.ErrItemUnavailable), errors.Is(err, payment.ErrDeclined):
+		code = codes.FailedPrecondition
+	case errors.Is(err, service.ErrLimitExceeded):
+		code = codes.ResourceExhausted
+	case errors.Is(err, payment.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	default:
+		slog.Error("call failed", slog.Any("error", err))
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	return status.Error(code, err.Error())
+}
+
+func recoveryUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer recoverPanic(info.FullMethod, &err)
+	return handler(ctx, req)
+}
+
+func recoveryStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer recoverPanic(info.FullMethod, &err)
+	return handler(srv, ss)
+}
+
+func recoverPanic(method string, err *error) {
+	if p := recover(); p != nil {
+		slog.Error("panic caught",
+			slog.String("method", method),
+			slog.Any("panic", p),
+			slog.String("stacktrace", string(debug.Stack())),
+		)
+
+		*err = status.Error(codes.Internal, "internal error")
+	}
+}
+
+func logUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	now := time.Now()
+
+	resp, err := handler(ctx, req)
+	logCall(info.FullMethod, now, err)
+
+	return resp, err
+}
+
+func logStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	now := time.Now()
+
+	err := handler(srv, ss)
+	logCall(info.FullMethod, now, err)
+
+	return err
+}
+
+func logCall(method string, start time.Time, err error) {
+	slog.Debug("call served",
+		slog.Duration("delay", time.Since(start)),
+		slog.String("method", method),
+		slog.String("code", status.Code(err).String()),
+	)
+}
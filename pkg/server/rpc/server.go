@@ -0,0 +1,209 @@
+// Package rpc implements gRPC API defined in api/flashsale/v1 on top of the services.
+package rpc
+
+//go:generate protoc -I ../../.. --go_out=../../.. --go_opt=paths=source_relative --go-grpc_out=../../.. --go-grpc_opt=paths=source_relative api/flashsale/v1/flashsale.proto
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/IlyushaZ/not-back-contest/api/flashsale/v1"
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+	"github.com/IlyushaZ/not-back-contest/pkg/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// checkoutTimeout is applied if caller hasn't set a shorter deadline, the same as for HTTP API.
+	checkoutTimeout = time.Second
+	// streamPageSize is the number of items fetched at once by StreamItems.
+	streamPageSize = 100
+)
+
+type Server struct {
+	pb.UnimplementedFlashSaleServer
+
+	items  service.Item
+	sales  service.Sale
+	signer model.CodeSigner
+}
+
+// New creates gRPC server serving FlashSale service.
+func New(itemSvc service.Item, saleSvc service.Sale, signer model.CodeSigner) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(recoveryUnary, logUnary),
+		grpc.ChainStreamInterceptor(recoveryStream, logStream),
+	)
+
+	pb.RegisterFlashSaleServer(srv, &Server{items: itemSvc, sales: saleSvc, signer: signer})
+
+	return srv
+}
+
+func (s *Server) Checkout(ctx context.Context, req *pb.CheckoutRequest) (*pb.CheckoutResponse, error) {
+	if req.UserId <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid user_id: %d", req.UserId)
+	}
+
+	items, err := model.NewCart(cartItems(req.Items))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkoutTimeout)
+	defer cancel()
+
+	var code string
+	if len(items) == 1 {
+		code, err = s.items.Checkout(ctx, int(req.UserId), items[0].ItemID, items[0].Quantity)
+	} else {
+		code, err = s.items.CheckoutCart(ctx, int(req.UserId), items)
+	}
+
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &pb.CheckoutResponse{Code: code}
+
+	if cc, err := s.signer.Verify(code); err == nil && !cc.Expires.IsZero() {
+		resp.ReservedUntil = timestamppb.New(cc.Expires)
+	}
+
+	return resp, nil
+}
+
+func (s *Server) Purchase(ctx context.Context, req *pb.PurchaseRequest) (*pb.PurchaseResponse, error) {
+	cc, err := s.signer.Verify(req.Code)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	if cc.Expired(time.Now()) {
+		return nil, status.Error(codes.NotFound, "no check out for given code found")
+	}
+
+	orders, err := s.items.Purchase(ctx, cc)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &pb.PurchaseResponse{Orders: make([]*pb.Order, 0, len(orders))}
+	for _, o := range orders {
+		resp.Orders = append(resp.Orders, orderToPB(o))
+	}
+
+	return resp, nil
+}
+
+func (s *Server) ListItems(ctx context.Context, req *pb.ListItemsRequest) (*pb.ListItemsResponse, error) {
+	pageSize, err := pageSize(req.PageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := model.ParseCursor(req.PageToken)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	items, next, err := s.items.ListPageAfter(ctx, itemFilter(req), cursor, pageSize)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &pb.ListItemsResponse{Items: make([]*pb.Item, 0, len(items))}
+	for _, item := range items {
+		resp.Items = append(resp.Items, itemToPB(item))
+	}
+
+	if next != nil {
+		resp.NextPageToken = next.String()
+	}
+
+	return resp, nil
+}
+
+func (s *Server) StreamItems(req *pb.ListItemsRequest, stream grpc.ServerStreamingServer[pb.Item]) error {
+	var (
+		ctx    = stream.Context()
+		filter = itemFilter(req)
+		cursor = model.Cursor{}
+	)
+
+	for {
+		items, next, err := s.items.ListPageAfter(ctx, filter, cursor, streamPageSize)
+		if err != nil {
+			return statusError(err)
+		}
+
+		for _, item := range items {
+			if err := stream.Send(itemToPB(item)); err != nil {
+				return err
+			}
+		}
+
+		if next == nil {
+			return nil
+		}
+
+		cursor = *next
+	}
+}
+
+func (s *Server) ListSales(ctx context.Context, req *pb.ListSalesRequest) (*pb.ListSalesResponse, error) {
+	pageSize, err := pageSize(req.PageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := model.ParseCursor(req.PageToken)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	sales, next, err := s.sales.ListPageAfter(ctx, cursor, pageSize)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &pb.ListSalesResponse{Sales: make([]*pb.Sale, 0, len(sales))}
+	for _, sale := range sales {
+		resp.Sales = append(resp.Sales, saleToPB(sale))
+	}
+
+	if next != nil {
+		resp.NextPageToken = next.String()
+	}
+
+	return resp, nil
+}
+
+func pageSize(size int32) (int, error) {
+	switch {
+	case size < 0:
+		return 0, status.Errorf(codes.InvalidArgument, "invalid page_size: %d", size)
+	case size == 0:
+		return service.DefaultPageSize, nil
+	default:
+		return int(size), nil
+	}
+}
+
+// cartItems converts items of the request, quantity of the item defaults to a single unit.
+func cartItems(items []*pb.CartItem) []model.CartItem {
+	cart := make([]model.CartItem, 0, len(items))
+	for _, item := range items {
+		quantity := int(item.Quantity)
+		if quantity == 0 {
+			quantity = 1
+		}
+
+		cart = append(cart, model.CartItem{ItemID: int(item.ItemId), Quantity: quantity})
+	}
+
+	return cart
+}
@@ -4,6 +4,9 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/IlyushaZ/not-back-contest/pkg/events"
+	"github.com/IlyushaZ/not-back-contest/pkg/idempotency"
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
 	"github.com/IlyushaZ/not-back-contest/pkg/server/handler"
 	"github.com/IlyushaZ/not-back-contest/pkg/server/middleware"
 	"github.com/IlyushaZ/not-back-contest/pkg/service"
@@ -14,17 +17,52 @@ const (
 	writeTimeout = 5 * time.Second
 )
 
-func New(addr string, itemSvc service.Item, saleSvc service.Sale) (*http.Server, error) {
+// New creates the server. Stream of sales' events is served only if bus is set,
+// Idempotency-Key header of checkouts and purchases is honoured only if idem is set.
+// wsOrigins are the origins allowed to open WebSocket connections besides the same origin.
+func New(addr, adminToken string, itemSvc service.Item, saleSvc service.Sale, signer model.CodeSigner, bus *events.Bus, idem *idempotency.Store, wsOrigins []string, expiryWarning time.Duration) (*http.Server, error) {
 	mux := http.NewServeMux()
 
-	mux.Handle("/checkout", handler.ItemCheckout(itemSvc))
-	mux.Handle("/purchase", handler.ItemPurchase(itemSvc))
+	idempotent := middleware.Chain{}
+	if idem != nil {
+		idempotent = append(idempotent, middleware.Idempotency(idem))
+	}
+
+	mux.Handle("/checkout", idempotent.Then(handler.ItemCheckout(itemSvc)))
+	mux.Handle("/checkout/any", handler.ItemCheckoutAny(itemSvc))
+	mux.Handle("/checkout/cancel", handler.ItemCancel(itemSvc, signer))
+	mux.Handle("/checkout/extend", handler.ItemExtend(itemSvc, signer))
+	mux.Handle("/purchase", idempotent.Then(handler.ItemPurchase(itemSvc, signer)))
+	mux.Handle("GET /ws", handler.ItemWebSocket(itemSvc, signer, wsOrigins, expiryWarning))
 	mux.Handle("/items", handler.ItemListPage(itemSvc))
 	mux.Handle("/sales", handler.SaleListPage(saleSvc))
+	mux.Handle("GET /sales/current", handler.SaleCurrent(saleSvc))
+	mux.Handle("GET /sales/upcoming", handler.SaleUpcoming(saleSvc))
+	mux.Handle("GET /sales/{id}/items", handler.SaleItems(itemSvc, saleSvc))
+	if bus != nil {
+		mux.Handle("GET /sales/{id}/events", handler.SaleEvents(saleSvc, bus))
+	}
+
+	mux.Handle("GET /users/{id}/purchases", handler.UserPurchases(itemSvc))
+	mux.Handle("GET /users/{id}/reservations", handler.UserReservations(itemSvc))
+
+	admin := http.NewServeMux()
+	admin.Handle("GET /admin/sales", handler.SaleListPage(saleSvc))
+	admin.Handle("POST /admin/sales", handler.SaleCreate(saleSvc))
+	admin.Handle("GET /admin/sales/{id}", handler.SaleGet(saleSvc))
+	admin.Handle("PATCH /admin/sales/{id}", handler.SaleUpdateWindow(saleSvc))
+	admin.Handle("PATCH /admin/sales/{id}/settings", handler.SaleUpdateSettings(saleSvc))
+	admin.Handle("DELETE /admin/sales/{id}", handler.SaleDelete(saleSvc))
+	admin.Handle("POST /admin/sales/{id}/pause", handler.SalePause(saleSvc))
+	admin.Handle("POST /admin/sales/{id}/resume", handler.SaleResume(saleSvc))
+	admin.Handle("POST /admin/orders/{id}/refund", handler.OrderRefund(itemSvc))
+
+	mux.Handle("/admin/", middleware.AdminAuth(adminToken)(admin))
 
 	chain := middleware.Chain{
 		middleware.Log,
 		middleware.Recovery,
+		middleware.UserID,
 	}
 
 	return &http.Server{
@@ -5,16 +5,38 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"time"
 
 	"github.com/IlyushaZ/not-back-contest/pkg/database"
+	"github.com/IlyushaZ/not-back-contest/pkg/events"
 	"github.com/IlyushaZ/not-back-contest/pkg/model"
+	"github.com/IlyushaZ/not-back-contest/pkg/payment"
 )
 
 type Item interface {
-	Checkout(ctx context.Context, userID, itemID int) (string, error)
-	Purchase(ctx context.Context, code model.CheckoutCode) error
-	ListPage(ctx context.Context, pageNum, pageSize int) ([]model.Item, int, error)
+	// Checkout reserves quantity units of the item.
+	Checkout(ctx context.Context, userID, itemID, quantity int) (string, error)
+	// CheckoutCart reserves all the items with a single code or none of them.
+	CheckoutCart(ctx context.Context, userID int, items []model.CartItem) (string, error)
+	// CheckoutAny reserves a unit of any available item of the sale and returns the code along with item's ID.
+	CheckoutAny(ctx context.Context, userID, saleID int) (string, int, error)
+	// Purchase buys all the units reserved with the code and returns the orders created, one per item.
+	Purchase(ctx context.Context, code model.CheckoutCode) ([]model.Order, error)
+	// Cancel releases all the units reserved with the code and returns them.
+	Cancel(ctx context.Context, code model.CheckoutCode) ([]model.CartItem, error)
+	// Refund returns units of the order and the money paid for them, see model.RefundRequest.
+	Refund(ctx context.Context, orderID int, req model.RefundRequest) (model.Refund, error)
+	Extend(ctx context.Context, code model.CheckoutCode) (time.Time, error)
+	ListPage(ctx context.Context, filter model.ItemFilter, pageNum, pageSize int) ([]model.Item, int, error)
+	// ListPageAfter returns a page of items following the cursor and the cursor of the next page, if any.
+	ListPageAfter(ctx context.Context, filter model.ItemFilter, after model.Cursor, pageSize int) ([]model.Item, *model.Cursor, error)
+	// EstimateTotal returns approximate number of items matching the filter, which is much cheaper to get than exact one.
+	EstimateTotal(ctx context.Context, filter model.ItemFilter) (int, error)
+	// ListPurchases returns a page of user's orders.
+	ListPurchases(ctx context.Context, userID, pageNum, pageSize int) ([]model.Order, int, error)
+	// ListReservations returns a page of user's reservations which can still be purchased.
+	ListReservations(ctx context.Context, userID, pageNum, pageSize int) ([]model.Reservation, int, error)
 }
 
 // ItemGeneric represents an implementation of Item interface containing core logics
@@ -22,23 +44,456 @@ type Item interface {
 type ItemGeneric struct {
 	ItemRepository     database.ItemRepository
 	CheckoutRepository database.CheckoutRepository
-	CheckoutTimeout    time.Duration
+	// Sales provides checkout timeouts of the sales.
+	Sales *SaleCache
+	// CheckoutExtension is how far reservation is pushed forward on each Extend call.
+	CheckoutExtension     time.Duration
+	MaxCheckoutExtensions int
+	// CodeGenerator generates nonces of checkout codes. model.DefaultCodeGenerator is used if not set.
+	CodeGenerator model.CodeGenerator
+	// CodeSigner turns checkout codes into the strings issued to users.
+	CodeSigner model.CodeSigner
+	// Payments charges user on purchase. Purchase is made without payment step if not set.
+	Payments       payment.Provider
+	PaymentTimeout time.Duration
+	// Events receives changes of items' stock. Nothing is published if not set.
+	Events *events.Bus
 }
 
-func (ig *ItemGeneric) Checkout(ctx context.Context, userID, itemID int) (code string, err error) {
-	cc := model.CheckoutCode{UserID: userID, ItemID: itemID}
-	cc.GenerateRand()
-	code = cc.String()
+func (ig *ItemGeneric) Checkout(ctx context.Context, userID, itemID, quantity int) (code string, err error) {
+	sale, err := ig.Sales.ByItem(ctx, itemID)
+	if err != nil {
+		return "", fmt.Errorf("can't get item's sale: %w", err)
+	}
+
+	timeout := sale.CheckoutTimeout.Duration()
+
+	cc := model.CheckoutCode{UserID: userID, ItemID: itemID, Expires: time.Now().Add(timeout)}
+	cc.GenerateRand(ig.CodeGenerator)
+	code = ig.CodeSigner.Sign(cc)
+
+	items := []model.CartItem{{ItemID: itemID, Quantity: quantity}}
+	defer func() { ig.saveCheckouts(ctx, userID, items, code, err) }()
+
+	err = ig.ItemRepository.Checkout(ctx, userID, itemID, quantity, cc, timeout)
+	if err != nil {
+		return "", fmt.Errorf("can't checkout item in DB: %w", err)
+	}
+
+	ig.publish(ctx, events.KindReserved, items)
+
+	return code, nil
+}
+
+// CheckoutCart expects items to be sorted by ID and to have no duplicates.
+// The code returned refers to the first item of the cart.
+// If items belong to different sales, the shortest checkout timeout of them is used.
+func (ig *ItemGeneric) CheckoutCart(ctx context.Context, userID int, items []model.CartItem) (code string, err error) {
+	if len(items) == 0 {
+		return "", errors.New("cart is empty")
+	}
+
+	sales := make([]model.Sale, 0, len(items))
+	for _, item := range items {
+		sale, err := ig.Sales.ByItem(ctx, item.ItemID)
+		if err != nil {
+			return "", fmt.Errorf("can't get item's sale: %w", err)
+		}
+
+		sales = append(sales, sale)
+	}
+
+	timeout := checkoutTimeout(sales...)
+
+	cc := model.CheckoutCode{UserID: userID, ItemID: items[0].ItemID, Expires: time.Now().Add(timeout)}
+	cc.GenerateRand(ig.CodeGenerator)
+	code = ig.CodeSigner.Sign(cc)
+
+	defer func() { ig.saveCheckouts(ctx, userID, items, code, err) }()
+
+	err = ig.ItemRepository.CheckoutMany(ctx, userID, items, cc, timeout)
+	if err != nil {
+		return "", fmt.Errorf("can't checkout items in DB: %w", err)
+	}
+
+	ig.publish(ctx, events.KindReserved, items)
+
+	return code, nil
+}
+
+func (ig *ItemGeneric) CheckoutAny(ctx context.Context, userID, saleID int) (code string, itemID int, err error) {
+	sale, err := ig.Sales.ByID(ctx, saleID)
+	if err != nil {
+		return "", 0, fmt.Errorf("can't get sale: %w", err)
+	}
+
+	timeout := sale.CheckoutTimeout.Duration()
+
+	cc := model.CheckoutCode{UserID: userID, Expires: time.Now().Add(timeout)}
+	cc.GenerateRand(ig.CodeGenerator)
+
+	itemID, err = ig.ItemRepository.CheckoutAny(ctx, userID, saleID, cc, timeout)
+	if err != nil {
+		err = fmt.Errorf("can't checkout any item in DB: %w", err)
+		// there is no particular item to save the attempt for, so it's saved for the sale
+		ig.saveAnyCheckout(ctx, userID, saleID, err)
+
+		return "", 0, err
+	}
+
+	cc.ItemID = itemID
+	code = ig.CodeSigner.Sign(cc)
+
+	items := []model.CartItem{{ItemID: itemID, Quantity: 1}}
+
+	ig.saveCheckouts(ctx, userID, items, code, nil)
+	ig.publish(ctx, events.KindReserved, items)
+
+	return code, itemID, nil
+}
+
+// DeclinedError is payment.ErrDeclined along with the units of the reservation which were put back on sale.
+type DeclinedError struct {
+	Released []model.CartItem
+	err      error
+}
+
+func (e *DeclinedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *DeclinedError) Unwrap() error {
+	return e.err
+}
+
+// Purchase charges user for the orders before committing them, if Payments is set.
+// When payment is declined, the reservation is released right away, so the units are back on sale,
+// and DeclinedError is returned.
+// When provider times out, the reservation is kept, so user may retry while it's not expired.
+// When money has been captured, but the purchase can't be completed, the reservation is left for reconciliation.
+func (ig *ItemGeneric) Purchase(ctx context.Context, code model.CheckoutCode) ([]model.Order, error) {
+	if ig.Payments == nil {
+		orders, err := ig.ItemRepository.Purchase(ctx, code, nil)
+		if err == nil {
+			ig.publishSold(orders)
+		}
+
+		return orders, err
+	}
+
+	var captured []string
+
+	orders, err := ig.ItemRepository.Purchase(ctx, code, func(orders []model.Order) (err error) {
+		captured, err = ig.pay(ctx, code, orders)
+		if err != nil && len(captured) > 0 {
+			// the reservation must not be released, while user is charged for it
+			return fmt.Errorf("%w: %v", database.ErrPaymentUnknown, err)
+		}
+
+		return err
+	})
+	switch {
+	case err != nil && len(captured) > 0:
+		// money has been charged, but the orders haven't been saved
+		slog.Error("payment captured for failed purchase, refund required",
+			slog.Int("user_id", code.UserID),
+			slog.Any("payment_ids", captured),
+			slog.Any("error", err),
+		)
+
+	case errors.Is(err, payment.ErrDeclined):
+		items, rerr := ig.release(ctx, code, model.CheckoutKindDeclined)
+		if rerr != nil {
+			slog.Error("can't release reservation after payment was declined", slog.Any("error", rerr))
+			break
+		}
+
+		err = &DeclinedError{Released: items, err: err}
+
+	case err == nil:
+		ig.publishSold(orders)
+	}
+
+	return orders, err
+}
+
+// pay authorizes and captures the price of the orders, one payment per currency, and sets orders' PaymentID.
+// Payment must be made within the reservation window, so it's given no more time than the code is valid for.
+// If some of the payments fail to be captured, the ones captured before are refunded.
+// IDs of captured payments which are not refunded are returned even if error occurs.
+func (ig *ItemGeneric) pay(ctx context.Context, code model.CheckoutCode, orders []model.Order) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, ig.PaymentTimeout)
+	defer cancel()
+
+	if !code.Expires.IsZero() {
+		var cancelExp context.CancelFunc
+		ctx, cancelExp = context.WithDeadline(ctx, code.Expires)
+		defer cancelExp()
+	}
+
+	var (
+		currencies []string
+		totals     = make(map[string]int64)
+	)
+
+	for _, o := range orders {
+		if _, ok := totals[o.Currency]; !ok {
+			currencies = append(currencies, o.Currency)
+		}
+
+		totals[o.Currency] += o.Total()
+	}
+
+	var (
+		authIDs    = make([]string, 0, len(currencies))
+		authAmount = make(map[string]int64, len(currencies))
+	)
+
+	for _, currency := range currencies {
+		authID, err := ig.Payments.Authorize(ctx, payment.Payment{
+			UserID:    code.UserID,
+			Amount:    totals[currency],
+			Currency:  currency,
+			Reference: code.Rand + ":" + currency,
+		})
+		if err != nil {
+			ig.void(ctx, authIDs...)
+			return nil, paymentError("can't authorize payment", err)
+		}
+
+		authIDs = append(authIDs, authID)
+		authAmount[authID] = totals[currency]
+
+		for i := range orders {
+			if orders[i].Currency == currency {
+				orders[i].PaymentID = authID
+			}
+		}
+	}
+
+	captured := make([]string, 0, len(authIDs))
+
+	for i, authID := range authIDs {
+		if err := ig.Payments.Capture(ctx, authID); err != nil {
+			// the ones which have already been captured can't be voided, so they are refunded
+			ig.void(ctx, authIDs[i:]...)
+			return ig.refundCaptured(ctx, code, captured, authAmount), paymentError("can't capture payment", err)
+		}
+
+		captured = append(captured, authID)
+	}
+
+	return captured, nil
+}
+
+// void voids authorizations even if ctx is done, since otherwise user's money stays held.
+func (ig *ItemGeneric) void(ctx context.Context, authIDs ...string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ig.PaymentTimeout)
+	defer cancel()
+
+	for _, authID := range authIDs {
+		if err := ig.Payments.Void(ctx, authID); err != nil {
+			slog.Error("can't void payment", slog.String("payment_id", authID), slog.Any("error", err))
+		}
+	}
+}
+
+// refundCaptured refunds captured payments of the purchase which can't be completed even if ctx is done,
+// since otherwise user stays charged. IDs of the payments which have failed to be refunded are returned.
+func (ig *ItemGeneric) refundCaptured(ctx context.Context, code model.CheckoutCode, paymentIDs []string, amounts map[string]int64) []string {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ig.PaymentTimeout)
+	defer cancel()
+
+	var failed []string
+
+	for _, paymentID := range paymentIDs {
+		if err := ig.Payments.Refund(ctx, paymentID, amounts[paymentID], code.Rand+":"+paymentID); err != nil {
+			slog.Error("can't refund payment", slog.String("payment_id", paymentID), slog.Any("error", err))
+			failed = append(failed, paymentID)
+		}
+	}
+
+	return failed
+}
+
+// paymentError reports provider's failure to respond in time as payment.ErrTimeout.
+func paymentError(msg string, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, payment.ErrTimeout) {
+		return fmt.Errorf("%s: %w: %w", msg, payment.ErrTimeout, err)
+	}
+
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// Cancel releases the reservation made with the code and stores the cancellation to checkouts.
+func (ig *ItemGeneric) Cancel(ctx context.Context, code model.CheckoutCode) ([]model.CartItem, error) {
+	return ig.release(ctx, code, model.CheckoutKindCancel)
+}
+
+// release releases the reservation made with the code and stores the records of given kind to checkouts.
+func (ig *ItemGeneric) release(ctx context.Context, code model.CheckoutCode, kind model.CheckoutKind) ([]model.CartItem, error) {
+	items, err := ig.ItemRepository.Cancel(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("can't cancel checkout in DB: %w", err)
+	}
+
+	now := time.Now()
+
+	cos := make([]model.Checkout, 0, len(items))
+	for _, item := range items {
+		cos = append(cos, model.Checkout{
+			Base:     model.Base{CreatedAt: now},
+			Kind:     kind,
+			UserID:   code.UserID,
+			ItemID:   item.ItemID,
+			Quantity: item.Quantity,
+			Code:     ig.CodeSigner.Sign(code),
+		})
+	}
+
+	if err := ig.CheckoutRepository.Add(ctx, cos...); err != nil {
+		slog.Error("can't save checkout cancellation to DB", slog.Any("error", err))
+	}
+
+	ig.publish(ctx, events.KindReleased, items)
 
-	defer func() {
-		if !shouldSaveCheckout(err) {
-			return
+	return items, nil
+}
+
+// Refund refunds the payment of the order (if it was paid) while the refund is pending and completes it after.
+// Refund's ID is passed to provider as the reference, so the refund left pending can be reconciled.
+func (ig *ItemGeneric) Refund(ctx context.Context, orderID int, req model.RefundRequest) (model.Refund, error) {
+	if req.Quantity < 0 {
+		return model.Refund{}, model.ErrInvalidRefund
+	}
+
+	refund, err := ig.ItemRepository.Refund(ctx, orderID, req, func(o model.Order, r model.Refund) error {
+		if o.PaymentID == "" || r.Amount == 0 {
+			return nil
+		}
+
+		if ig.Payments == nil {
+			return errors.New("order was paid, but no payment provider is configured to refund it")
 		}
 
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ig.PaymentTimeout)
+		defer cancel()
+
+		err := ig.Payments.Refund(ctx, o.PaymentID, r.Amount, "refund:"+strconv.Itoa(r.ID))
+		switch {
+		case errors.Is(err, payment.ErrDeclined):
+			return fmt.Errorf("can't refund payment: %w", err)
+		case err != nil:
+			// money may have been returned, unless provider has refused to do it
+			return fmt.Errorf("%w: %w", database.ErrPaymentUnknown, paymentError("can't refund payment", err))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return model.Refund{}, err
+	}
+
+	if refund.Restocked && ig.Events != nil {
+		ig.Events.Publish(events.Event{Kind: events.KindReleased, SaleID: refund.SaleID, ItemID: refund.ItemID, Quantity: refund.Quantity})
+	}
+
+	return refund, nil
+}
+
+// Extend keeps the reservation made with the code alive for CheckoutExtension more
+// and returns the time until which the item is reserved now.
+func (ig *ItemGeneric) Extend(ctx context.Context, code model.CheckoutCode) (time.Time, error) {
+	return ig.ItemRepository.Extend(ctx, code, ig.CheckoutExtension, ig.MaxCheckoutExtensions)
+}
+
+func (ig *ItemGeneric) ListPage(ctx context.Context, filter model.ItemFilter, pageNum, pageSize int) ([]model.Item, int, error) {
+	if !filter.Valid() {
+		return nil, 0, model.ErrInvalidItemFilter
+	}
+
+	return ig.ItemRepository.GetPage(ctx, filter, pageNum, pageSize)
+}
+
+func (ig *ItemGeneric) ListPageAfter(ctx context.Context, filter model.ItemFilter, after model.Cursor, pageSize int) ([]model.Item, *model.Cursor, error) {
+	if !filter.Valid() {
+		return nil, nil, model.ErrInvalidItemFilter
+	}
+
+	return ig.ItemRepository.GetPageAfter(ctx, filter, after, pageSize)
+}
+
+func (ig *ItemGeneric) EstimateTotal(ctx context.Context, filter model.ItemFilter) (int, error) {
+	if !filter.Valid() {
+		return 0, model.ErrInvalidItemFilter
+	}
+
+	return ig.ItemRepository.EstimateCount(ctx, filter)
+}
+
+func (ig *ItemGeneric) ListPurchases(ctx context.Context, userID, pageNum, pageSize int) ([]model.Order, int, error) {
+	return ig.ItemRepository.GetUserOrders(ctx, userID, pageNum, pageSize)
+}
+
+func (ig *ItemGeneric) ListReservations(ctx context.Context, userID, pageNum, pageSize int) ([]model.Reservation, int, error) {
+	return ig.ItemRepository.GetUserReservations(ctx, userID, pageNum, pageSize)
+}
+
+// publish publishes the change of stock of the items, if Events is set.
+func (ig *ItemGeneric) publish(ctx context.Context, kind events.Kind, items []model.CartItem) {
+	publishStock(ctx, ig.Events, ig.Sales, kind, items)
+}
+
+func (ig *ItemGeneric) publishSold(orders []model.Order) {
+	if ig.Events == nil {
+		return
+	}
+
+	evs := make([]events.Event, 0, len(orders))
+	for _, o := range orders {
+		evs = append(evs, events.Event{Kind: events.KindSold, SaleID: o.SaleID, ItemID: o.ItemID, Quantity: o.Quantity})
+	}
+
+	ig.Events.Publish(evs...)
+}
+
+// publishStock publishes the change of stock of the items to bus, resolving their sales with sales.
+// Stream is best-effort, so the items which sale can't be resolved are skipped.
+func publishStock(ctx context.Context, bus *events.Bus, sales *SaleCache, kind events.Kind, items []model.CartItem) {
+	if bus == nil {
+		return
+	}
+
+	evs := make([]events.Event, 0, len(items))
+	for _, item := range items {
+		sale, err := sales.ByItem(ctx, item.ItemID)
+		if err != nil {
+			slog.Error("can't get item's sale to publish event", slog.Int("item_id", item.ItemID), slog.Any("error", err))
+			continue
+		}
+
+		evs = append(evs, events.Event{Kind: kind, SaleID: sale.ID, ItemID: item.ItemID, Quantity: item.Quantity})
+	}
+
+	bus.Publish(evs...)
+}
+
+// saveCheckouts stores checkout attempt of each item to DB.
+func (ig *ItemGeneric) saveCheckouts(ctx context.Context, userID int, items []model.CartItem, code string, err error) {
+	if !shouldSaveCheckout(err) {
+		return
+	}
+
+	now := time.Now()
+
+	cos := make([]model.Checkout, 0, len(items))
+	for _, item := range items {
 		co := model.Checkout{
-			Base:   model.Base{CreatedAt: time.Now()},
-			UserID: userID,
-			ItemID: itemID,
+			Base:     model.Base{CreatedAt: now},
+			Kind:     model.CheckoutKindCheckout,
+			UserID:   userID,
+			ItemID:   item.ItemID,
+			Quantity: item.Quantity,
 		}
 
 		if err == nil {
@@ -47,25 +502,44 @@ func (ig *ItemGeneric) Checkout(ctx context.Context, userID, itemID int) (code s
 			co.Error = err.Error()
 		}
 
-		if err := ig.CheckoutRepository.Add(ctx, co); err != nil {
-			slog.Error("can't save checkout to DB", slog.Any("error", err))
-		}
-	}()
-
-	err = ig.ItemRepository.Checkout(ctx, userID, itemID, cc, ig.CheckoutTimeout)
-	if err != nil {
-		return "", fmt.Errorf("can't checkout item in DB: %w", err)
+		cos = append(cos, co)
 	}
 
-	return code, nil
+	if err := ig.CheckoutRepository.Add(ctx, cos...); err != nil {
+		slog.Error("can't save checkout to DB", slog.Any("error", err))
+	}
 }
 
-func (ig *ItemGeneric) Purchase(ctx context.Context, code model.CheckoutCode) error {
-	return ig.ItemRepository.Purchase(ctx, code)
+// saveAnyCheckout stores failed attempt to checkout any item of the sale to DB.
+func (ig *ItemGeneric) saveAnyCheckout(ctx context.Context, userID, saleID int, err error) {
+	if !shouldSaveCheckout(err) {
+		return
+	}
+
+	co := model.Checkout{
+		Base:   model.Base{CreatedAt: time.Now()},
+		Kind:   model.CheckoutKindCheckout,
+		UserID: userID,
+		SaleID: saleID,
+		Error:  err.Error(),
+	}
+
+	if err := ig.CheckoutRepository.Add(ctx, co); err != nil {
+		slog.Error("can't save checkout to DB", slog.Any("error", err))
+	}
 }
 
-func (ig *ItemGeneric) ListPage(ctx context.Context, pageNum, pageSize int) ([]model.Item, int, error) {
-	return ig.ItemRepository.GetPage(ctx, pageNum, pageSize)
+// checkoutTimeout returns the shortest checkout timeout of the sales.
+func checkoutTimeout(sales ...model.Sale) time.Duration {
+	var timeout time.Duration
+
+	for i, sale := range sales {
+		if t := sale.CheckoutTimeout.Duration(); i == 0 || t < timeout {
+			timeout = t
+		}
+	}
+
+	return timeout
 }
 
 func shouldSaveCheckout(err error) bool {
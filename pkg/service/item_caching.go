@@ -15,7 +15,7 @@ import (
 )
 
 const (
-	checkoutsKeyPrefix = "checkouts:"
+	unavailableKeyPrefix = "unavailable:"
 )
 
 var (
@@ -24,116 +24,276 @@ var (
 
 // ItemCaching is a caching layer which is intended to be called before ItemGeneric.
 // It may be helpful if we see that single item is tried to be checked out many times.
+//
+// Since items have stock now, there is no single user holding the item to be cached.
+// Instead, when checkout fails because the item has not enough units left, this is remembered for a while,
+// so the following checkouts of the same (or bigger) quantity are rejected without going to DB.
+// Units are returned to stock on cancel or declined payment (the cache is dropped then) or on expiration,
+// that's why the cache lives only for a short time.
 type ItemCaching struct {
 	Item
 
-	redis           *redis.Client
-	checkoutTimeout time.Duration
+	redis *redis.Client
+	sales *SaleCache
+	ttl   time.Duration
 	// the more number of instances we have - the more useless this cache becomes,
-	// but it does not give much overhead (i guess so)
-	localCache []checkoutCacheVal
+	// but it does not give much overhead (i guess so).
+	// Local cache is split by sales, each of them gets as many slots as it has items.
+	localCache map[int]*localSale
 	// TODO: we can get rid of mutex
 	// or cut down the time spent on locking by sharding local cache into multiple segments.
 	mu sync.RWMutex
 }
 
-func NewItemCaching(i Item, redis *redis.Client, checkoutTimeout time.Duration, itemsPerSale int) *ItemCaching {
+type localSale struct {
+	endAt time.Time
+	slots []unavailableCacheVal
+}
+
+func NewItemCaching(i Item, redis *redis.Client, sales *SaleCache, ttl time.Duration) *ItemCaching {
 	ic := &ItemCaching{
-		Item:            i,
-		redis:           redis,
-		checkoutTimeout: checkoutTimeout,
-		localCache:      make([]checkoutCacheVal, itemsPerSale),
+		Item:       i,
+		redis:      redis,
+		sales:      sales,
+		ttl:        ttl,
+		localCache: make(map[int]*localSale),
 	}
 
 	return ic
 }
 
-type checkoutCacheVal struct {
-	until  time.Time
-	itemID int // only for local cache
-	userID int
-	code   string
+// unavailableCacheVal tells that item had less than quantity units available at the moment.
+type unavailableCacheVal struct {
+	until    time.Time
+	saleID   int // only for local cache
+	itemID   int // only for local cache
+	quantity int
 }
 
-func (c checkoutCacheVal) String() string {
-	return strconv.Itoa(c.userID) + "|" + strconv.FormatInt(c.until.Unix(), 10) + "|" + c.code
+func (c unavailableCacheVal) String() string {
+	return strconv.Itoa(c.quantity) + "|" + strconv.FormatInt(c.until.UnixMilli(), 10)
 }
 
-// Checkout calls to Item.Checkout, but checks whether the item is checked out using cache.
-// It may help in cases when we have many checkouts with single item.
-// If redis has no info about item's checkout or checkout has already expired, we use slower path (go to DB).
+// Checkout calls to Item.Checkout unless cache says that the item doesn't have enough units.
+// If redis has no info about item or info has already expired, we use slower path (go to DB).
 // Errors occurring when calling redis are not returned.
-func (ic *ItemCaching) Checkout(ctx context.Context, userID, itemID int) (code string, err error) {
+func (ic *ItemCaching) Checkout(ctx context.Context, userID, itemID, quantity int) (code string, err error) {
+	now := time.Now()
+
+	sale, err := ic.sales.ByItem(ctx, itemID)
+	if err != nil {
+		slog.Error("can't get item's sale, skipping cache", slog.Any("error", err))
+		return ic.Item.Checkout(ctx, userID, itemID, quantity)
+	}
+
+	if ic.unavailable(ctx, sale, model.CartItem{ItemID: itemID, Quantity: quantity}, now) {
+		slog.Debug("someone cooked here")
+		return "", model.ErrItemUnavailable
+	}
+
+	// slower path - try to checkout in DB
+	code, err = ic.Item.Checkout(ctx, userID, itemID, quantity)
+	// the item is also unavailable while the sale is not active, which must not outlive the start of the sale
+	if errors.Is(err, model.ErrItemUnavailable) && sale.Active(now) {
+		ic.setUnavailable(unavailableCacheVal{now.Add(ic.ttl), sale.ID, itemID, quantity})
+	}
+
+	return
+}
+
+// CheckoutCart calls to Item.CheckoutCart unless cache says that some of the items don't have enough units.
+// It's unknown which of the items has caused the failure, so nothing is cached on the way back.
+func (ic *ItemCaching) CheckoutCart(ctx context.Context, userID int, items []model.CartItem) (code string, err error) {
 	now := time.Now()
 
-	ccv, err := ic.getCheckoutCacheVal(ctx, itemID, now)
+	for _, item := range items {
+		sale, err := ic.sales.ByItem(ctx, item.ItemID)
+		if err != nil {
+			slog.Error("can't get item's sale, skipping cache", slog.Any("error", err))
+			break
+		}
+
+		if ic.unavailable(ctx, sale, item, now) {
+			return "", model.ErrItemUnavailable
+		}
+	}
+
+	return ic.Item.CheckoutCart(ctx, userID, items)
+}
+
+// Cancel calls to Item.Cancel and drops the cached info of released items from both local cache and redis,
+// so the items are shown as available right away.
+func (ic *ItemCaching) Cancel(ctx context.Context, code model.CheckoutCode) ([]model.CartItem, error) {
+	items, err := ic.Item.Cancel(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	ic.forget(ctx, items)
+
+	return items, nil
+}
+
+// Purchase calls to Item.Purchase and drops the cached info of the items which were put back on sale
+// because payment was declined.
+func (ic *ItemCaching) Purchase(ctx context.Context, code model.CheckoutCode) ([]model.Order, error) {
+	orders, err := ic.Item.Purchase(ctx, code)
+
+	var de *DeclinedError
+	if errors.As(err, &de) && len(de.Released) > 0 {
+		ic.forget(ctx, de.Released)
+	}
+
+	return orders, err
+}
+
+// Refund calls to Item.Refund and drops the cached info of the item if its units were put back on sale.
+func (ic *ItemCaching) Refund(ctx context.Context, orderID int, req model.RefundRequest) (model.Refund, error) {
+	refund, err := ic.Item.Refund(ctx, orderID, req)
+	if err != nil {
+		return refund, err
+	}
+
+	if refund.Restocked {
+		ic.forget(ctx, []model.CartItem{{ItemID: refund.ItemID, Quantity: refund.Quantity}})
+	}
+
+	return refund, nil
+}
+
+// forget drops the cached info of the items whose units have been returned to stock.
+func (ic *ItemCaching) forget(ctx context.Context, items []model.CartItem) {
+	for _, item := range items {
+		sale, err := ic.sales.ByItem(ctx, item.ItemID)
+		if err != nil {
+			slog.Error("can't get item's sale", slog.Any("error", err))
+			continue
+		}
+
+		ic.mu.Lock()
+		if ls, ok := ic.localCache[sale.ID]; ok {
+			localIdx := item.ItemID % len(ls.slots)
+			if ls.slots[localIdx].itemID == item.ItemID {
+				ls.slots[localIdx] = unavailableCacheVal{}
+			}
+		}
+		ic.mu.Unlock()
+	}
+
+	go func() {
+		redisCtx, cancel := context.WithTimeout(context.TODO(), time.Second)
+		defer cancel()
+
+		keys := make([]string, 0, len(items))
+		for _, item := range items {
+			keys = append(keys, unavailableCacheKey(item.ItemID))
+		}
+
+		if err := ic.redis.Del(redisCtx, keys...).Err(); err != nil {
+			slog.Error("can't delete item info from redis", slog.Any("error", err))
+		}
+	}()
+}
+
+// unavailable checks whether cache says that the item doesn't have enough units.
+func (ic *ItemCaching) unavailable(ctx context.Context, sale model.Sale, item model.CartItem, now time.Time) bool {
+	ucv, err := ic.getUnavailableCacheVal(ctx, sale, item.ItemID, now)
 	switch {
 	case errors.Is(err, errCacheMiss):
-		// do nothing
+		return false
 
 	case err != nil:
-		slog.Error("can't get checkout info from cache", slog.Any("error", err))
+		slog.Error("can't get item info from cache", slog.Any("error", err))
+		return false
 
 	default:
-		if now.Before(ccv.until) {
-			if ccv.userID == userID { // it's us who had checked out the item before
-				return ccv.code, nil
-			}
+		return now.Before(ucv.until) && item.Quantity >= ucv.quantity
+	}
+}
 
-			slog.Debug("someone cooked here")
+// ensureLocalSale makes sure that local cache has slots for the sale.
+func (ic *ItemCaching) ensureLocalSale(sale model.Sale) {
+	ic.mu.RLock()
+	_, ok := ic.localCache[sale.ID]
+	ic.mu.RUnlock()
 
-			return "", model.ErrItemUnavailable
-		}
+	if ok {
+		return
 	}
 
-	// slower path - try to checkout in DB
-	code, err = ic.Item.Checkout(ctx, userID, itemID)
-	if err != nil {
+	now := time.Now()
+
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	if _, ok := ic.localCache[sale.ID]; ok {
 		return
 	}
 
-	ccv = checkoutCacheVal{now.Add(ic.checkoutTimeout), itemID, userID, code}
+	// drop slots of the sales which have already ended, checkouts can't be made there anyway
+	for id, ls := range ic.localCache {
+		if ls.endAt.Before(now) {
+			delete(ic.localCache, id)
+		}
+	}
+
+	ic.localCache[sale.ID] = &localSale{
+		endAt: sale.EndAt,
+		slots: make([]unavailableCacheVal, max(sale.ItemsCount, 1)),
+	}
+}
 
+// setUnavailable saves item info to local cache and, asynchronously, to redis.
+func (ic *ItemCaching) setUnavailable(ucv unavailableCacheVal) {
 	ic.mu.Lock()
-	ic.localCache[itemID%len(ic.localCache)] = ccv
+	if ls, ok := ic.localCache[ucv.saleID]; ok {
+		localIdx := ucv.itemID % len(ls.slots)
+		// keep the smallest quantity known to be unavailable
+		if prev := ls.slots[localIdx]; prev.itemID == ucv.itemID && prev.until.After(time.Now()) {
+			ucv.quantity = min(ucv.quantity, prev.quantity)
+		}
+
+		ls.slots[localIdx] = ucv
+	}
 	ic.mu.Unlock()
 
 	go func() {
 		redisCtx, cancel := context.WithTimeout(context.TODO(), time.Second)
 		defer cancel()
 
-		key := checkoutCacheKey(itemID)
-
 		// i guess we can not really concern about atomicity here,
-		// because only one user buying this item will reach this code section at a time
-		if err = ic.redis.Set(redisCtx, key, ccv.String(), ic.checkoutTimeout).Err(); err != nil {
-			slog.Error("can't set checkout info in redis", slog.Any("error", err))
+		// the worst thing to happen is that the item is checked in DB once more
+		ttl := time.Until(ucv.until)
+		if ttl <= 0 {
+			return
 		}
-	}()
 
-	return
+		if err := ic.redis.Set(redisCtx, unavailableCacheKey(ucv.itemID), ucv.String(), ttl).Err(); err != nil {
+			slog.Error("can't set item info in redis", slog.Any("error", err))
+		}
+	}()
 }
 
-func (ic *ItemCaching) getCheckoutCacheVal(ctx context.Context, itemID int, now time.Time) (checkoutCacheVal, error) {
-	var (
-		localIdx = itemID % len(ic.localCache)
-		ccv      checkoutCacheVal
-		err      error
-	)
+func (ic *ItemCaching) getUnavailableCacheVal(ctx context.Context, sale model.Sale, itemID int, now time.Time) (unavailableCacheVal, error) {
+	ic.ensureLocalSale(sale)
+
+	var ucv unavailableCacheVal
 
 	ic.mu.RLock()
-	ccv = ic.localCache[localIdx]
+	if ls, ok := ic.localCache[sale.ID]; ok {
+		ucv = ls.slots[itemID%len(ls.slots)]
+	}
 	ic.mu.RUnlock()
 
 	// Check the date as well because when it's more than one instance running,
-	// someone could have already checked out the item through the other instance.
+	// the item could have become unavailable through the other instance.
 	// In this case we should go to redis anyway
-	if ccv.itemID == itemID && now.Before(ccv.until) {
+	if ucv.itemID == itemID && now.Before(ucv.until) {
 		slog.Debug("found value in local cache", slog.Int("item_id", itemID))
-		return ccv, nil
+		return ucv, nil
 	}
 
-	key := checkoutCacheKey(itemID)
+	key := unavailableCacheKey(itemID)
 
 	redisCtx, cancel := context.WithTimeout(ctx, time.Millisecond*300)
 	defer cancel()
@@ -141,54 +301,56 @@ func (ic *ItemCaching) getCheckoutCacheVal(ctx context.Context, itemID int, now
 	val, err := ic.redis.Get(redisCtx, key).Result()
 	switch {
 	case err == redis.Nil:
-		return ccv, errCacheMiss
+		return ucv, errCacheMiss
 	case err != nil:
-		return ccv, fmt.Errorf("can't get checkout info from redis: %w", err)
+		return ucv, fmt.Errorf("can't get item info from redis: %w", err)
 
 	default:
-		ccv, err := parseCheckoutCacheVal(val)
+		ucv, err := parseUnavailableCacheVal(val)
 		if err != nil {
-			return ccv, fmt.Errorf("can't parse checkout cache val: %w", err)
+			return ucv, fmt.Errorf("can't parse item cache val: %w", err)
 		}
 
-		ccv.itemID = itemID
+		ucv.saleID = sale.ID
+		ucv.itemID = itemID
 
 		// populate local cache
 		ic.mu.Lock()
-		ic.localCache[localIdx] = ccv
+		if ls, ok := ic.localCache[sale.ID]; ok {
+			ls.slots[itemID%len(ls.slots)] = ucv
+		}
 		ic.mu.Unlock()
 
-		return ccv, nil
+		return ucv, nil
 	}
 }
 
-func checkoutCacheKey(itemID int) string {
-	return checkoutsKeyPrefix + strconv.Itoa(itemID)
+func unavailableCacheKey(itemID int) string {
+	return unavailableKeyPrefix + strconv.Itoa(itemID)
 }
 
-func parseCheckoutCacheVal(val string) (checkoutCacheVal, error) {
+func parseUnavailableCacheVal(val string) (unavailableCacheVal, error) {
 	split := strings.Split(val, "|")
-	if len(split) != 3 {
-		return checkoutCacheVal{}, fmt.Errorf("expected val to consist of 3 parts, got %d", len(split))
+	if len(split) != 2 {
+		return unavailableCacheVal{}, fmt.Errorf("expected val to consist of 2 parts, got %d", len(split))
 	}
 
 	var (
-		ccv checkoutCacheVal
+		ucv unavailableCacheVal
 		err error
 	)
 
-	ccv.userID, err = strconv.Atoi(split[0])
+	ucv.quantity, err = strconv.Atoi(split[0])
 	if err != nil {
-		return checkoutCacheVal{}, fmt.Errorf("can't parse userID: %w", err)
+		return unavailableCacheVal{}, fmt.Errorf("can't parse quantity: %w", err)
 	}
 
 	ts, err := strconv.ParseInt(split[1], 10, 64)
 	if err != nil {
-		return checkoutCacheVal{}, fmt.Errorf("can't parse timestamp: %w", err)
+		return unavailableCacheVal{}, fmt.Errorf("can't parse timestamp: %w", err)
 	}
 
-	ccv.until = time.Unix(ts, 0)
-	ccv.code = split[2]
+	ucv.until = time.UnixMilli(ts)
 
-	return ccv, nil
+	return ucv, nil
 }
@@ -2,18 +2,38 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
+	"github.com/IlyushaZ/not-back-contest/pkg/database"
 	"github.com/IlyushaZ/not-back-contest/pkg/limiter"
 	"github.com/IlyushaZ/not-back-contest/pkg/model"
+	"github.com/IlyushaZ/not-back-contest/pkg/payment"
 )
 
 var ErrLimitExceeded = errors.New("used exceeded his limit")
 
+// LimitError is ErrLimitExceeded along with the time after which the limit may let user through again.
+type LimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return ErrLimitExceeded.Error()
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
 // ItemLimiting is a wrapper over Item service
-// which makes sure that user can make no more than LimitPerUser checkout requests per sale.
+// which makes sure that user can buy no more than sale's PurchasesLimit units per sale.
+//
+// Units are counted against the limit on checkout, so user can't reserve more of them than he's allowed to buy.
+// They are given back on cancel and once the reservation expires or payment is declined.
 //
 // If failed to check limits, the behavior depends on FailOpen flag. If set, current request is allowed.
 // Otherwise, an error will be returned.
@@ -21,48 +41,237 @@ type ItemLimiting struct {
 	Item
 
 	Limiter  *limiter.Limiter
+	Sales    *SaleCache
 	FailOpen bool
+	// MaxExtension is how far reservation may be pushed beyond sale's checkout timeout by extensions,
+	// so the units which haven't been given back explicitly are only counted as long as they may be reserved.
+	MaxExtension time.Duration
+	// CodeSigner parses the codes issued by Item to find out their nonces.
+	CodeSigner model.CodeSigner
+}
+
+// Checkout counts every unit checked out against user's limit.
+func (ic *ItemLimiting) Checkout(ctx context.Context, userID, itemID, quantity int) (code string, err error) {
+	sale, err := ic.itemSale(ctx, itemID)
+	if err != nil {
+		return "", err
+	}
+
+	perSale := map[int]saleItems{sale.ID: {sale: sale, count: quantity}}
+
+	id, err := ic.reserve(ctx, userID, perSale)
+	if err != nil {
+		return "", err
+	}
+
+	code, err = ic.Item.Checkout(ctx, userID, itemID, quantity)
+	ic.settle(ctx, userID, id, code, err)
+
+	return code, err
+}
+
+// CheckoutCart counts every unit of the cart against user's limit for the sale it belongs to.
+func (ic *ItemLimiting) CheckoutCart(ctx context.Context, userID int, items []model.CartItem) (code string, err error) {
+	perSale, err := ic.countPerSale(ctx, items)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := ic.reserve(ctx, userID, perSale)
+	if err != nil {
+		return "", err
+	}
+
+	code, err = ic.Item.CheckoutCart(ctx, userID, items)
+	ic.settle(ctx, userID, id, code, err)
+
+	return code, err
 }
 
-func (ic *ItemLimiting) Checkout(ctx context.Context, userID, itemID int) (code string, err error) {
-	exceeded, err := ic.Limiter.LimitExceeded(ctx, userID)
+func (ic *ItemLimiting) CheckoutAny(ctx context.Context, userID, saleID int) (code string, itemID int, err error) {
+	sale, err := ic.Sales.ByID(ctx, saleID)
+	if errors.Is(err, database.ErrNotFound) {
+		return "", 0, model.ErrItemUnavailable
+	} else if err != nil {
+		return "", 0, err
+	}
+
+	id, err := ic.reserve(ctx, userID, map[int]saleItems{sale.ID: {sale: sale, count: 1}})
 	if err != nil {
-		if !ic.FailOpen {
-			return "", fmt.Errorf("can't check if limit exceeded: %w", err)
+		return "", 0, err
+	}
+
+	code, itemID, err = ic.Item.CheckoutAny(ctx, userID, saleID)
+	ic.settle(ctx, userID, id, code, err)
+
+	return code, itemID, err
+}
+
+// Purchase turns the units reserved on checkout into purchases, so they are counted until the end of the sale.
+// Purchase itself is never rejected by the limit, as the units have been counted on checkout.
+func (ic *ItemLimiting) Purchase(ctx context.Context, code model.CheckoutCode) (orders []model.Order, err error) {
+	orders, err = ic.Item.Purchase(ctx, code)
+	if err != nil {
+		// the reservation has been released or has expired, while the timed out payment may still be retried
+		if errors.Is(err, payment.ErrDeclined) || errors.Is(err, database.ErrNotFound) {
+			ic.release(ctx, code)
 		}
 
-		slog.Error("can't check if limit exceeded", slog.Any("error", err))
+		return
+	}
+
+	items := make([]model.CartItem, 0, len(orders))
+	for _, o := range orders {
+		items = append(items, model.CartItem{ItemID: o.ItemID, Quantity: o.Quantity})
+	}
+
+	perSale, err := ic.countPerSale(ctx, items)
+	if err != nil {
+		slog.Error("can't get sales of purchased items", slog.Any("error", err))
+		return orders, nil
+	}
+
+	for _, si := range perSale {
+		if err := ic.Limiter.Commit(ctx, code.UserID, si.sale, code.Rand, si.count); err != nil {
+			slog.Error("can't commit user's limit", slog.Any("error", err))
+		}
 	}
 
-	if exceeded {
-		return "", ErrLimitExceeded
+	return orders, nil
+}
+
+// Cancel gives the units of the reservation back to user's limit.
+func (ic *ItemLimiting) Cancel(ctx context.Context, code model.CheckoutCode) ([]model.CartItem, error) {
+	items, err := ic.Item.Cancel(ctx, code)
+	if err == nil || errors.Is(err, database.ErrNotFound) {
+		ic.release(ctx, code)
 	}
 
-	return ic.Item.Checkout(ctx, userID, itemID)
+	return items, err
 }
 
-func (ic *ItemLimiting) Purchase(ctx context.Context, code model.CheckoutCode) (err error) {
-	exceeded, err := ic.Limiter.LimitExceeded(ctx, code.UserID)
+// Refund gives the refunded units back to user's limit for the sale.
+func (ic *ItemLimiting) Refund(ctx context.Context, orderID int, req model.RefundRequest) (model.Refund, error) {
+	refund, err := ic.Item.Refund(ctx, orderID, req)
+	if err != nil {
+		return refund, err
+	}
+
+	sale, err := ic.Sales.ByID(ctx, refund.SaleID)
 	if err != nil {
-		if !ic.FailOpen {
-			return fmt.Errorf("can't check if limit exceeded: %w", err)
+		slog.Error("can't get sale of refunded order", slog.Any("error", err))
+		return refund, nil
+	}
+
+	if err := ic.Limiter.Decrement(ctx, refund.UserID, sale, refund.Quantity); err != nil {
+		slog.Error("can't decrement user's limit", slog.Any("error", err))
+	}
+
+	return refund, nil
+}
+
+// reserve counts the units against user's limit for each of the sales under a temporary ID, which is returned.
+// If any of the sales' limits is exceeded, nothing is reserved and LimitError is returned.
+// Units are counted as long as they may stay reserved, so they are given back even if release fails.
+func (ic *ItemLimiting) reserve(ctx context.Context, userID int, perSale map[int]saleItems) (string, error) {
+	id := rand.Text()
+
+	var timeout time.Duration
+	for _, si := range perSale {
+		timeout = max(timeout, si.sale.CheckoutTimeout.Duration())
+	}
+
+	until := time.Now().Add(timeout + ic.MaxExtension)
+
+	for _, si := range perSale {
+		ok, retryAt, err := ic.Limiter.Reserve(ctx, userID, si.sale, id, si.count, until)
+		if err != nil {
+			if !ic.FailOpen {
+				ic.releaseID(ctx, userID, id)
+				return "", fmt.Errorf("can't check if limit exceeded: %w", err)
+			}
+
+			slog.Error("can't check if limit exceeded", slog.Any("error", err))
+			continue
 		}
 
-		slog.Error("can't check if limit exceeded", slog.Any("error", err))
+		if !ok {
+			ic.releaseID(ctx, userID, id)
+
+			// purchases are given back to the limit only on refund, so in general it lasts until the end of the sale
+			if retryAt.IsZero() {
+				retryAt = si.sale.EndAt
+			}
+
+			return "", &LimitError{RetryAfter: time.Until(retryAt)}
+		}
 	}
 
-	if exceeded {
-		return ErrLimitExceeded
+	return id, nil
+}
+
+// settle gives the units reserved under id back if checkout has failed.
+// Otherwise, they are moved to the code, so they can be found on purchase, cancel or expiration.
+func (ic *ItemLimiting) settle(ctx context.Context, userID int, id, code string, err error) {
+	// checkout may have failed because of the deadline, which must not leave the units counted
+	ctx = context.WithoutCancel(ctx)
+
+	if err != nil {
+		ic.releaseID(ctx, userID, id)
+		return
 	}
 
-	err = ic.Item.Purchase(ctx, code)
+	cc, err := ic.CodeSigner.Verify(code)
 	if err != nil {
+		slog.Error("can't parse issued code", slog.Any("error", err))
 		return
 	}
 
-	if _, err := ic.Limiter.Increment(ctx, code.UserID); err != nil {
-		slog.Error("can't increment user's limit", slog.Any("error", err))
+	if err := ic.Limiter.Rename(ctx, userID, id, cc.Rand); err != nil {
+		slog.Error("can't rename user's reservation", slog.Any("error", err))
+	}
+}
+
+func (ic *ItemLimiting) release(ctx context.Context, code model.CheckoutCode) {
+	ic.releaseID(ctx, code.UserID, code.Rand)
+}
+
+func (ic *ItemLimiting) releaseID(ctx context.Context, userID int, id string) {
+	if err := ic.Limiter.Release(ctx, userID, id); err != nil {
+		slog.Error("can't release user's reservation", slog.Any("error", err))
+	}
+}
+
+// itemSale returns the sale of the item. Items which don't exist are reported as unavailable.
+func (ic *ItemLimiting) itemSale(ctx context.Context, itemID int) (model.Sale, error) {
+	sale, err := ic.Sales.ByItem(ctx, itemID)
+	if errors.Is(err, database.ErrNotFound) {
+		return model.Sale{}, model.ErrItemUnavailable
+	}
+
+	return sale, err
+}
+
+type saleItems struct {
+	sale  model.Sale
+	count int
+}
+
+// countPerSale sums up units of the items by their sales' IDs.
+func (ic *ItemLimiting) countPerSale(ctx context.Context, items []model.CartItem) (map[int]saleItems, error) {
+	perSale := make(map[int]saleItems)
+
+	for _, item := range items {
+		sale, err := ic.itemSale(ctx, item.ItemID)
+		if err != nil {
+			return nil, err
+		}
+
+		si := perSale[sale.ID]
+		si.sale = sale
+		si.count += item.Quantity
+		perSale[sale.ID] = si
 	}
 
-	return err
+	return perSale, nil
 }
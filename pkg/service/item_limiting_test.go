@@ -0,0 +1,318 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/database"
+	"github.com/IlyushaZ/not-back-contest/pkg/limiter"
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+	"github.com/IlyushaZ/not-back-contest/pkg/payment"
+	"github.com/IlyushaZ/not-back-contest/pkg/service"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	testUserID = 1
+	testItemID = 10
+	testSaleID = 5
+)
+
+var testSigner = func() *model.HMACCodeSigner {
+	signer, err := model.NewHMACCodeSigner([]model.CodeKey{{ID: "test", Secret: []byte("secret")}}, false)
+	if err != nil {
+		panic(err)
+	}
+
+	return signer
+}()
+
+// stubItem issues codes with sequential nonces and fails with the errors set.
+type stubItem struct {
+	service.Item
+
+	checkoutErr error
+	purchaseErr error
+
+	mu         sync.Mutex
+	seq        int
+	quantities map[string]int // by nonce
+}
+
+func (si *stubItem) Checkout(ctx context.Context, userID, itemID, quantity int) (string, error) {
+	if si.checkoutErr != nil {
+		return "", si.checkoutErr
+	}
+
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	si.seq++
+	nonce := "nonce" + strconv.Itoa(si.seq)
+
+	if si.quantities == nil {
+		si.quantities = make(map[string]int)
+	}
+	si.quantities[nonce] = quantity
+
+	return testSigner.Sign(model.CheckoutCode{UserID: userID, ItemID: itemID, Rand: nonce, Expires: time.Now().Add(time.Minute)}), nil
+}
+
+func (si *stubItem) Purchase(ctx context.Context, code model.CheckoutCode) ([]model.Order, error) {
+	if si.purchaseErr != nil {
+		return nil, si.purchaseErr
+	}
+
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	return []model.Order{{UserID: code.UserID, ItemID: code.ItemID, SaleID: testSaleID, Quantity: si.quantities[code.Rand]}}, nil
+}
+
+func (si *stubItem) Cancel(ctx context.Context, code model.CheckoutCode) ([]model.CartItem, error) {
+	return nil, nil
+}
+
+type stubItemRepository struct {
+	database.ItemRepository
+}
+
+func (stubItemRepository) GetSaleID(ctx context.Context, itemID int) (int, error) {
+	return testSaleID, nil
+}
+
+type stubSaleRepository struct {
+	database.SaleRepository
+	sale model.Sale
+}
+
+func (sr stubSaleRepository) Get(ctx context.Context, id int) (model.Sale, error) {
+	return sr.sale, nil
+}
+
+func newTestItemLimiting(t *testing.T, item *stubItem, limit int) (*service.ItemLimiting, *miniredis.Miniredis) {
+	t.Helper()
+
+	m := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	now := time.Now()
+
+	sale := model.Sale{
+		StartAt:         now.Add(-time.Hour),
+		EndAt:           now.Add(time.Hour),
+		PurchasesLimit:  limit,
+		CheckoutTimeout: model.Duration(time.Minute),
+	}
+	sale.ID = testSaleID
+
+	return &service.ItemLimiting{
+		Item:       item,
+		Limiter:    &limiter.Limiter{Redis: client},
+		Sales:      service.NewSaleCache(stubItemRepository{}, stubSaleRepository{sale: sale}, time.Minute),
+		CodeSigner: testSigner,
+	}, m
+}
+
+func checkout(t *testing.T, il *service.ItemLimiting, quantity int) model.CheckoutCode {
+	t.Helper()
+
+	code, err := il.Checkout(context.Background(), testUserID, testItemID, quantity)
+	if err != nil {
+		t.Fatalf("Checkout() unexpected error: %v", err)
+	}
+
+	cc, err := testSigner.Verify(code)
+	if err != nil {
+		t.Fatalf("can't verify issued code: %v", err)
+	}
+
+	return cc
+}
+
+func requireLimitExceeded(t *testing.T, err error) {
+	t.Helper()
+
+	var le *service.LimitError
+	if !errors.As(err, &le) {
+		t.Fatalf("expected LimitError, got %v", err)
+	}
+
+	if le.RetryAfter <= 0 {
+		t.Errorf("expected positive RetryAfter, got %v", le.RetryAfter)
+	}
+}
+
+func userFields(m *miniredis.Miniredis) []string {
+	fields, _ := m.HKeys("limiter:" + strconv.Itoa(testUserID))
+	return fields
+}
+
+func TestItemLimiting_CheckoutMovesReservationToCode(t *testing.T) {
+	il, m := newTestItemLimiting(t, &stubItem{}, 2)
+
+	cc := checkout(t, il, 2)
+
+	fields := userFields(m)
+	if len(fields) != 1 || fields[0] != "r:5:"+cc.Rand {
+		t.Fatalf("expected the units to be reserved under the nonce of the code, got fields %v", fields)
+	}
+
+	_, err := il.Checkout(context.Background(), testUserID, testItemID, 1)
+	requireLimitExceeded(t, err)
+}
+
+func TestItemLimiting_FailedCheckoutReleasesReservation(t *testing.T) {
+	il, m := newTestItemLimiting(t, &stubItem{checkoutErr: model.ErrItemUnavailable}, 1)
+
+	if _, err := il.Checkout(context.Background(), testUserID, testItemID, 1); !errors.Is(err, model.ErrItemUnavailable) {
+		t.Fatalf("expected error of Item to be returned, got %v", err)
+	}
+
+	if fields := userFields(m); len(fields) != 0 {
+		t.Fatalf("expected nothing to be reserved, got fields %v", fields)
+	}
+}
+
+func TestItemLimiting_ReleasesOnCancelAndDecline(t *testing.T) {
+	tests := []struct {
+		name    string
+		release func(il *service.ItemLimiting, item *stubItem, cc model.CheckoutCode) error
+	}{
+		{
+			name: "cancel",
+			release: func(il *service.ItemLimiting, _ *stubItem, cc model.CheckoutCode) error {
+				_, err := il.Cancel(context.Background(), cc)
+				return err
+			},
+		},
+		{
+			name: "declined payment",
+			release: func(il *service.ItemLimiting, item *stubItem, cc model.CheckoutCode) error {
+				item.purchaseErr = payment.ErrDeclined
+				if _, err := il.Purchase(context.Background(), cc); !errors.Is(err, payment.ErrDeclined) {
+					return fmt.Errorf("expected %v, got %v", payment.ErrDeclined, err)
+				}
+
+				return nil
+			},
+		},
+		{
+			name: "expired reservation",
+			release: func(il *service.ItemLimiting, item *stubItem, cc model.CheckoutCode) error {
+				item.purchaseErr = database.ErrNotFound
+				if _, err := il.Purchase(context.Background(), cc); !errors.Is(err, database.ErrNotFound) {
+					return fmt.Errorf("expected %v, got %v", database.ErrNotFound, err)
+				}
+
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := &stubItem{}
+			il, m := newTestItemLimiting(t, item, 1)
+
+			cc := checkout(t, il, 1)
+
+			if err := tt.release(il, item, cc); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if fields := userFields(m); len(fields) != 0 {
+				t.Fatalf("expected reservation to be released, got fields %v", fields)
+			}
+
+			item.purchaseErr = nil
+			checkout(t, il, 1)
+		})
+	}
+}
+
+func TestItemLimiting_TimedOutPaymentKeepsReservation(t *testing.T) {
+	item := &stubItem{}
+	il, m := newTestItemLimiting(t, item, 1)
+
+	cc := checkout(t, il, 1)
+
+	item.purchaseErr = payment.ErrTimeout
+	if _, err := il.Purchase(context.Background(), cc); !errors.Is(err, payment.ErrTimeout) {
+		t.Fatalf("expected payment.ErrTimeout, got %v", err)
+	}
+
+	if fields := userFields(m); len(fields) != 1 || fields[0] != "r:5:"+cc.Rand {
+		t.Fatalf("expected reservation to be kept for retry, got fields %v", fields)
+	}
+}
+
+func TestItemLimiting_PurchaseCommitsReservation(t *testing.T) {
+	il, m := newTestItemLimiting(t, &stubItem{}, 2)
+
+	cc := checkout(t, il, 2)
+
+	if _, err := il.Purchase(context.Background(), cc); err != nil {
+		t.Fatalf("Purchase() unexpected error: %v", err)
+	}
+
+	if fields := userFields(m); len(fields) != 1 || fields[0] != "p:5" {
+		t.Fatalf("expected reservation to be turned into purchases, got fields %v", fields)
+	}
+
+	// cancel of the purchased code doesn't give the purchases back
+	if _, err := il.Cancel(context.Background(), cc); err != nil {
+		t.Fatalf("Cancel() unexpected error: %v", err)
+	}
+
+	_, err := il.Checkout(context.Background(), testUserID, testItemID, 1)
+	requireLimitExceeded(t, err)
+}
+
+func TestItemLimiting_ConcurrentCheckouts(t *testing.T) {
+	il, m := newTestItemLimiting(t, &stubItem{}, 3)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved int
+	)
+
+	for range 20 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := il.Checkout(context.Background(), testUserID, testItemID, 1)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+			case err == nil:
+				reserved++
+			case !errors.Is(err, service.ErrLimitExceeded):
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if reserved != 3 {
+		t.Fatalf("expected exactly 3 checkouts to succeed, got %d", reserved)
+	}
+
+	if fields := userFields(m); len(fields) != 3 {
+		t.Errorf("expected 3 reservations to be kept, got fields %v", fields)
+	}
+}
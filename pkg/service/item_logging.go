@@ -12,11 +12,12 @@ type ItemLogging struct {
 	Item
 }
 
-func (il *ItemLogging) Checkout(ctx context.Context, userID, itemID int) (code string, err error) {
+func (il *ItemLogging) Checkout(ctx context.Context, userID, itemID, quantity int) (code string, err error) {
 	defer func(t0 time.Time) {
 		log := slog.With(
 			slog.Int("user_id", userID),
 			slog.Int("item_id", itemID),
+			slog.Int("quantity", quantity),
 			slog.String("resp", "HIDDEN"),
 			slog.String("delay", time.Since(t0).String()),
 		)
@@ -28,13 +29,54 @@ func (il *ItemLogging) Checkout(ctx context.Context, userID, itemID int) (code s
 		}
 	}(time.Now())
 
-	return il.Item.Checkout(ctx, userID, itemID)
+	return il.Item.Checkout(ctx, userID, itemID, quantity)
 }
 
-func (il *ItemLogging) Purchase(ctx context.Context, code model.CheckoutCode) (err error) {
+func (il *ItemLogging) CheckoutCart(ctx context.Context, userID int, items []model.CartItem) (code string, err error) {
 	defer func(t0 time.Time) {
 		log := slog.With(
-			slog.String("code", code.String()),
+			slog.Int("user_id", userID),
+			slog.Any("items", items),
+			slog.String("resp", "HIDDEN"),
+			slog.String("delay", time.Since(t0).String()),
+		)
+
+		if err != nil {
+			log.Error("failed to checkout cart", slog.Any("error", err))
+		} else {
+			log.Debug("called Item.CheckoutCart")
+		}
+	}(time.Now())
+
+	return il.Item.CheckoutCart(ctx, userID, items)
+}
+
+func (il *ItemLogging) CheckoutAny(ctx context.Context, userID, saleID int) (code string, itemID int, err error) {
+	defer func(t0 time.Time) {
+		log := slog.With(
+			slog.Int("user_id", userID),
+			slog.Int("sale_id", saleID),
+			slog.Int("item_id", itemID),
+			slog.String("resp", "HIDDEN"),
+			slog.String("delay", time.Since(t0).String()),
+		)
+
+		if err != nil {
+			log.Error("failed to checkout any item", slog.Any("error", err))
+		} else {
+			log.Debug("called Item.CheckoutAny")
+		}
+	}(time.Now())
+
+	return il.Item.CheckoutAny(ctx, userID, saleID)
+}
+
+func (il *ItemLogging) Purchase(ctx context.Context, code model.CheckoutCode) (orders []model.Order, err error) {
+	defer func(t0 time.Time) {
+		log := slog.With(
+			slog.Int("user_id", code.UserID),
+			slog.Int("item_id", code.ItemID),
+			slog.Any("orders", orders),
 			slog.String("delay", time.Since(t0).String()),
 		)
 
@@ -47,3 +89,60 @@ func (il *ItemLogging) Purchase(ctx context.Context, code model.CheckoutCode) (e
 
 	return il.Item.Purchase(ctx, code)
 }
+
+func (il *ItemLogging) Cancel(ctx context.Context, code model.CheckoutCode) (items []model.CartItem, err error) {
+	defer func(t0 time.Time) {
+		log := slog.With(
+			slog.Int("user_id", code.UserID),
+			slog.Int("item_id", code.ItemID),
+			slog.Any("items", items),
+			slog.String("delay", time.Since(t0).String()),
+		)
+
+		if err != nil {
+			log.Error("failed to cancel checkout", slog.Any("error", err))
+		} else {
+			log.Debug("called Item.Cancel")
+		}
+	}(time.Now())
+
+	return il.Item.Cancel(ctx, code)
+}
+
+func (il *ItemLogging) Refund(ctx context.Context, orderID int, req model.RefundRequest) (refund model.Refund, err error) {
+	defer func(t0 time.Time) {
+		log := slog.With(
+			slog.Int("order_id", orderID),
+			slog.Any("req", req),
+			slog.Any("refund", refund),
+			slog.String("delay", time.Since(t0).String()),
+		)
+
+		if err != nil {
+			log.Error("failed to refund order", slog.Any("error", err))
+		} else {
+			log.Debug("called Item.Refund")
+		}
+	}(time.Now())
+
+	return il.Item.Refund(ctx, orderID, req)
+}
+
+func (il *ItemLogging) Extend(ctx context.Context, code model.CheckoutCode) (until time.Time, err error) {
+	defer func(t0 time.Time) {
+		log := slog.With(
+			slog.Int("user_id", code.UserID),
+			slog.Int("item_id", code.ItemID),
+			slog.Time("until", until),
+			slog.String("delay", time.Since(t0).String()),
+		)
+
+		if err != nil {
+			log.Error("failed to extend checkout", slog.Any("error", err))
+		} else {
+			log.Debug("called Item.Extend")
+		}
+	}(time.Now())
+
+	return il.Item.Extend(ctx, code)
+}
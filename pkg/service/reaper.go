@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/database"
+	"github.com/IlyushaZ/not-back-contest/pkg/events"
+	"github.com/IlyushaZ/not-back-contest/pkg/limiter"
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+)
+
+// Reaper periodically releases reservations which have expired without purchase.
+// Units are taken from stock on checkout, so without it they never become available again.
+//
+// Reservations left on hold for payment by the instance which has failed to finish the purchase are not released,
+// as money may have been charged for them. They are flagged as 'payment_unknown' and reported to be reconciled.
+//
+// Reaper is safe to run on every instance, as the database makes sure only one of them releases items at a time.
+type Reaper struct {
+	ItemRepository database.ItemRepository
+	Interval       time.Duration
+	BatchSize      int
+	// Events receives released units along with Sales used to resolve sales of the items. Nothing is published if not set.
+	Events *events.Bus
+	Sales  *SaleCache
+	// Limiter gets the units back to users' limits, if set.
+	Limiter *limiter.Limiter
+}
+
+// Run blocks until ctx is done.
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reap(ctx)
+		}
+	}
+}
+
+// stalePaymentAfter is how long reservation may stay on hold for payment after it has expired. Payment is never waited
+// for longer than the reservation lasts, so the ones held longer are surely left by the failed instance.
+const stalePaymentAfter = 10 * time.Minute
+
+func (r *Reaper) reap(ctx context.Context) {
+	r.flagStalePayments(ctx)
+
+	// keep releasing while there are full batches, so the backlog is not carried over to the next tick
+	for {
+		cos, err := r.ItemRepository.ReleaseExpired(ctx, r.BatchSize)
+		if err != nil {
+			slog.Error("can't release expired reservations", slog.Any("error", err))
+			return
+		}
+
+		if len(cos) > 0 {
+			slog.Debug("released expired reservations", slog.Int("count", len(cos)))
+			r.publish(ctx, cos)
+			r.release(ctx, cos)
+		}
+
+		if len(cos) < r.BatchSize || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (r *Reaper) flagStalePayments(ctx context.Context) {
+	rs, err := r.ItemRepository.FlagStalePayments(ctx, stalePaymentAfter)
+	if err != nil {
+		slog.Error("can't flag stale payments", slog.Any("error", err))
+		return
+	}
+
+	for _, res := range rs {
+		slog.Error("purchase left unfinished, payment must be reconciled",
+			slog.Int("reservation_id", res.ID),
+			slog.Int("user_id", res.UserID),
+			slog.Int("item_id", res.ItemID),
+			slog.Int("quantity", res.Quantity),
+		)
+	}
+}
+
+// release gives the units back to users' limits, once per reservation, as cart is reserved with a single code.
+func (r *Reaper) release(ctx context.Context, cos []model.Checkout) {
+	if r.Limiter == nil {
+		return
+	}
+
+	type reservation struct {
+		userID int
+		code   string
+	}
+
+	released := make(map[reservation]bool, len(cos))
+	for _, co := range cos {
+		res := reservation{userID: co.UserID, code: co.Code}
+		if released[res] {
+			continue
+		}
+
+		released[res] = true
+
+		if err := r.Limiter.Release(ctx, co.UserID, co.Code); err != nil {
+			slog.Error("can't release user's reservation", slog.Any("error", err))
+		}
+	}
+}
+
+func (r *Reaper) publish(ctx context.Context, cos []model.Checkout) {
+	if r.Events == nil {
+		return
+	}
+
+	items := make([]model.CartItem, 0, len(cos))
+	for _, co := range cos {
+		items = append(items, model.CartItem{ItemID: co.ItemID, Quantity: max(co.Quantity, 1)})
+	}
+
+	publishStock(ctx, r.Events, r.Sales, events.KindReleased, items)
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/IlyushaZ/not-back-contest/pkg/database"
 	"github.com/IlyushaZ/not-back-contest/pkg/model"
@@ -9,12 +11,135 @@ import (
 
 type Sale interface {
 	ListPage(ctx context.Context, pageNum, pageSize int) ([]model.Sale, int, error)
+	// ListPageAfter returns a page of sales following the cursor and the cursor of the next page, if any.
+	ListPageAfter(ctx context.Context, after model.Cursor, pageSize int) ([]model.Sale, *model.Cursor, error)
+	EstimateTotal(ctx context.Context) (int, error)
+	Get(ctx context.Context, id int) (model.Sale, error)
+	// Current returns the sales which are running at the moment, including paused ones.
+	Current(ctx context.Context) ([]model.Sale, error)
+	// Upcoming returns up to limit sales which haven't started yet, the nearest first.
+	Upcoming(ctx context.Context, limit int) ([]model.Sale, error)
+	// Stats returns live counts of units of the sales by their IDs.
+	Stats(ctx context.Context, saleIDs []int) (map[int]model.SaleStats, error)
+	// Create creates the sale with given window, settings and items.
+	// Settings which are not set are taken from the defaults.
+	Create(ctx context.Context, start, end time.Time, settings model.SaleSettings, items []model.Item) (model.Sale, error)
+	UpdateWindow(ctx context.Context, id int, start, end time.Time) (model.Sale, error)
+	UpdateSettings(ctx context.Context, id int, settings model.SaleSettings) (model.Sale, error)
+	// Pause makes items of the sale unavailable for checkout and purchase until the sale is resumed.
+	Pause(ctx context.Context, id int) (model.Sale, error)
+	Resume(ctx context.Context, id int) (model.Sale, error)
+	Delete(ctx context.Context, id int) error
 }
 
 type SaleGeneric struct {
 	SaleRepository database.SaleRepository
+	// DefaultSettings are used for new sales which don't have their own settings.
+	DefaultSettings model.SaleSettings
 }
 
 func (sg *SaleGeneric) ListPage(ctx context.Context, pageNum, pageSize int) ([]model.Sale, int, error) {
 	return sg.SaleRepository.GetPage(ctx, pageNum, pageSize)
 }
+
+func (sg *SaleGeneric) ListPageAfter(ctx context.Context, after model.Cursor, pageSize int) ([]model.Sale, *model.Cursor, error) {
+	return sg.SaleRepository.GetPageAfter(ctx, after, pageSize)
+}
+
+func (sg *SaleGeneric) EstimateTotal(ctx context.Context) (int, error) {
+	return sg.SaleRepository.EstimateCount(ctx)
+}
+
+func (sg *SaleGeneric) Get(ctx context.Context, id int) (model.Sale, error) {
+	return sg.SaleRepository.Get(ctx, id)
+}
+
+func (sg *SaleGeneric) Current(ctx context.Context) ([]model.Sale, error) {
+	return sg.SaleRepository.GetActive(ctx, time.Now())
+}
+
+func (sg *SaleGeneric) Upcoming(ctx context.Context, limit int) ([]model.Sale, error) {
+	return sg.SaleRepository.GetUpcoming(ctx, time.Now(), limit)
+}
+
+func (sg *SaleGeneric) Stats(ctx context.Context, saleIDs []int) (map[int]model.SaleStats, error) {
+	if len(saleIDs) == 0 {
+		return map[int]model.SaleStats{}, nil
+	}
+
+	return sg.SaleRepository.GetStats(ctx, saleIDs)
+}
+
+func (sg *SaleGeneric) Create(ctx context.Context, start, end time.Time, settings model.SaleSettings, items []model.Item) (model.Sale, error) {
+	if !end.After(start) {
+		return model.Sale{}, model.ErrInvalidSaleWindow
+	}
+
+	if settings.PurchasesLimit == 0 {
+		settings.PurchasesLimit = sg.DefaultSettings.PurchasesLimit
+	}
+
+	if settings.CheckoutTimeout == 0 {
+		settings.CheckoutTimeout = sg.DefaultSettings.CheckoutTimeout
+	}
+
+	if !settings.Valid() {
+		return model.Sale{}, model.ErrInvalidSaleSettings
+	}
+
+	for i := range items {
+		if items[i].OriginalPrice == 0 {
+			items[i].OriginalPrice = items[i].Price
+		}
+
+		if items[i].Currency == "" {
+			items[i].Currency = model.DefaultCurrency
+		}
+
+		if !items[i].ValidPrice() {
+			return model.Sale{}, fmt.Errorf("item #%d: %w", i, model.ErrInvalidPrice)
+		}
+	}
+
+	s := model.Sale{
+		Base:            model.Base{CreatedAt: time.Now()},
+		StartAt:         start,
+		EndAt:           end,
+		PurchasesLimit:  settings.PurchasesLimit,
+		CheckoutTimeout: settings.CheckoutTimeout,
+	}
+
+	if err := sg.SaleRepository.Create(ctx, &s, items); err != nil {
+		return model.Sale{}, err
+	}
+
+	return s, nil
+}
+
+func (sg *SaleGeneric) UpdateWindow(ctx context.Context, id int, start, end time.Time) (model.Sale, error) {
+	if !end.After(start) {
+		return model.Sale{}, model.ErrInvalidSaleWindow
+	}
+
+	return sg.SaleRepository.UpdateWindow(ctx, id, start, end)
+}
+
+func (sg *SaleGeneric) UpdateSettings(ctx context.Context, id int, settings model.SaleSettings) (model.Sale, error) {
+	if !settings.Valid() {
+		return model.Sale{}, model.ErrInvalidSaleSettings
+	}
+
+	return sg.SaleRepository.UpdateSettings(ctx, id, settings)
+}
+
+func (sg *SaleGeneric) Pause(ctx context.Context, id int) (model.Sale, error) {
+	return sg.SaleRepository.SetPaused(ctx, id, true)
+}
+
+func (sg *SaleGeneric) Resume(ctx context.Context, id int) (model.Sale, error) {
+	return sg.SaleRepository.SetPaused(ctx, id, false)
+}
+
+func (sg *SaleGeneric) Delete(ctx context.Context, id int) error {
+	return sg.SaleRepository.Delete(ctx, id)
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/database"
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+)
+
+// maxCachedItems bounds the number of item to sale mappings kept in SaleCache.
+const maxCachedItems = 100_000
+
+// SaleCache resolves sales of items in-process. Items never move between sales,
+// so item to sale mapping is cached for good, while sales themselves are refreshed every TTL,
+// since their window may be changed.
+type SaleCache struct {
+	ItemRepository database.ItemRepository
+	SaleRepository database.SaleRepository
+	TTL            time.Duration
+
+	mu        sync.RWMutex
+	itemSales map[int]int
+	sales     map[int]cachedSale
+}
+
+type cachedSale struct {
+	sale      model.Sale
+	fetchedAt time.Time
+}
+
+func NewSaleCache(items database.ItemRepository, sales database.SaleRepository, ttl time.Duration) *SaleCache {
+	return &SaleCache{
+		ItemRepository: items,
+		SaleRepository: sales,
+		TTL:            ttl,
+		itemSales:      make(map[int]int),
+		sales:          make(map[int]cachedSale),
+	}
+}
+
+// ByItem returns the sale which the item belongs to.
+func (sc *SaleCache) ByItem(ctx context.Context, itemID int) (model.Sale, error) {
+	sc.mu.RLock()
+	saleID, ok := sc.itemSales[itemID]
+	sc.mu.RUnlock()
+
+	if !ok {
+		var err error
+
+		saleID, err = sc.ItemRepository.GetSaleID(ctx, itemID)
+		if err != nil {
+			return model.Sale{}, fmt.Errorf("can't get sale of item %d: %w", itemID, err)
+		}
+
+		sc.mu.Lock()
+		// items of past sales are not requested anymore, so it's simpler to start over than to evict
+		if len(sc.itemSales) >= maxCachedItems {
+			clear(sc.itemSales)
+		}
+		sc.itemSales[itemID] = saleID
+		sc.mu.Unlock()
+	}
+
+	return sc.ByID(ctx, saleID)
+}
+
+func (sc *SaleCache) ByID(ctx context.Context, saleID int) (model.Sale, error) {
+	now := time.Now()
+
+	sc.mu.RLock()
+	cs, ok := sc.sales[saleID]
+	sc.mu.RUnlock()
+
+	if ok && now.Sub(cs.fetchedAt) < sc.TTL {
+		return cs.sale, nil
+	}
+
+	sale, err := sc.SaleRepository.Get(ctx, saleID)
+	if err != nil {
+		return model.Sale{}, fmt.Errorf("can't get sale %d: %w", saleID, err)
+	}
+
+	sc.mu.Lock()
+	// drop the sales which have already ended, so the map doesn't grow forever
+	for id, cs := range sc.sales {
+		if cs.sale.EndAt.Before(now) && now.Sub(cs.fetchedAt) >= sc.TTL {
+			delete(sc.sales, id)
+		}
+	}
+	sc.sales[saleID] = cachedSale{sale, now}
+	sc.mu.Unlock()
+
+	return sale, nil
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/IlyushaZ/not-back-contest/pkg/model"
+)
+
+// SaleCaching is a wrapper over Sale service which serves stats of the sales from in-process cache,
+// since they are polled by every client waiting for the sale to start and counting units of the whole sale is not cheap.
+// Stats may be up to TTL stale.
+type SaleCaching struct {
+	Sale
+
+	ttl time.Duration
+
+	mu    sync.Mutex
+	stats map[int]cachedStats
+	// fetchMu makes concurrent requests wait for a single query instead of running the same one all together
+	fetchMu sync.Mutex
+}
+
+type cachedStats struct {
+	stats     model.SaleStats
+	fetchedAt time.Time
+}
+
+func NewSaleCaching(s Sale, ttl time.Duration) *SaleCaching {
+	return &SaleCaching{
+		Sale:  s,
+		ttl:   ttl,
+		stats: make(map[int]cachedStats),
+	}
+}
+
+func (sc *SaleCaching) Stats(ctx context.Context, saleIDs []int) (map[int]model.SaleStats, error) {
+	stats, missing := sc.cached(saleIDs)
+	if len(missing) == 0 {
+		return stats, nil
+	}
+
+	sc.fetchMu.Lock()
+	defer sc.fetchMu.Unlock()
+
+	// someone may have fetched them while we were waiting
+	stats, missing = sc.cached(saleIDs)
+	if len(missing) == 0 {
+		return stats, nil
+	}
+
+	fetched, err := sc.Sale.Stats(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	// drop stale stats, so the map doesn't grow with the sales which aren't requested anymore
+	for id, cs := range sc.stats {
+		if now.Sub(cs.fetchedAt) >= sc.ttl {
+			delete(sc.stats, id)
+		}
+	}
+
+	// sales without items are cached as well, so they don't go to DB on every request
+	for _, id := range missing {
+		sc.stats[id] = cachedStats{fetched[id], now}
+		stats[id] = fetched[id]
+	}
+
+	return stats, nil
+}
+
+// cached returns the stats which are cached and fresh and IDs of the sales which are not.
+func (sc *SaleCaching) cached(saleIDs []int) (map[int]model.SaleStats, []int) {
+	var (
+		now     = time.Now()
+		stats   = make(map[int]model.SaleStats, len(saleIDs))
+		missing []int
+	)
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for _, id := range saleIDs {
+		if cs, ok := sc.stats[id]; ok && now.Sub(cs.fetchedAt) < sc.ttl {
+			stats[id] = cs.stats
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	return stats, missing
+}